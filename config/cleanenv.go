@@ -34,6 +34,10 @@ const (
 
 	// TagEnvRequired flag to mark a field as required
 	TagEnvRequired = "env-required"
+
+	// TagEnvPrefix prefix of the environment variables of a nested structure,
+	// it is added to the prefix of the parent structure
+	TagEnvPrefix = "env-prefix"
 )
 
 type Setter interface {
@@ -226,7 +230,11 @@ func readStructMetadata(cfgRoot interface{}) ([]structMeta, error) {
 				}
 				// add structure to parsing stack
 				if _, found := validStructs[fld.Type()]; !found {
-					cfgStack = append(cfgStack, cfgNode{fld.Addr().Interface(), sPrefix})
+					prefix := sPrefix
+					if p, ok := fType.Tag.Lookup(TagEnvPrefix); ok {
+						prefix += p
+					}
+					cfgStack = append(cfgStack, cfgNode{fld.Addr().Interface(), prefix})
 					continue
 				}
 
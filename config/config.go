@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 )
 
 var defaultConfigPath = "./config/config.yaml"
@@ -29,7 +30,8 @@ func MustLoadConfig(cfg interface{}) {
 // LoadConfig loads the application configuration into the provided struct.
 // It first attempts to find a configuration file by checking the "CONFIG" environment variable.
 // If the environment variable is not set, it looks for a default configuration file in the
-// "./config/config.yaml" path relative to the current working directory. If neither is found,
+// "./config/config.yaml" path relative to the current working directory, a relative CONFIG is
+// resolved against the working directory too, an absolute one is used as is. If neither is found,
 // it falls back to loading configuration values from environment variables.
 //
 // The function supports overriding the main configuration file with a local configuration file.
@@ -55,8 +57,10 @@ func LoadConfig(cfg interface{}) error {
 	if !exists {
 		configFile = defaultConfigPath
 	}
-	currentDir, _ := os.Getwd()
-	configFile = path.Join(currentDir, configFile)
+	if !filepath.IsAbs(configFile) {
+		currentDir, _ := os.Getwd()
+		configFile = path.Join(currentDir, configFile)
+	}
 	if _, err := os.Stat(configFile); err == nil {
 		err = readFileWithLocal(configFile, cfg)
 		if err != nil {
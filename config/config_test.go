@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -46,6 +47,54 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestLoadConfig_absolutePath(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("dsn: amqp://file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG", file)
+
+	cfg := testConnStruct{}
+	if err := LoadConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DSN != "amqp://file" {
+		t.Errorf("expected the dsn of %s, got %q", file, cfg.DSN)
+	}
+}
+
+type testConnStruct struct {
+	DSN      string `yaml:"dsn" env:"DSN" env-required:"true"`
+	Exchange string `yaml:"exchange" env:"EXCHANGE" env-default:"events"`
+}
+
+type testPrefixStruct struct {
+	Orders testConnStruct `yaml:"orders" env-prefix:"ORDERS_"`
+	Mails  testConnStruct `yaml:"mails" env-prefix:"MAILS_"`
+}
+
+func TestReadEnv_prefix(t *testing.T) {
+	os.Setenv("ORDERS_DSN", "amqp://orders")
+	os.Setenv("MAILS_DSN", "amqp://mails")
+	os.Setenv("MAILS_EXCHANGE", "mail")
+	defer func() {
+		os.Unsetenv("ORDERS_DSN")
+		os.Unsetenv("MAILS_DSN")
+		os.Unsetenv("MAILS_EXCHANGE")
+	}()
+
+	cfg := testPrefixStruct{}
+	if err := ReadEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Orders.DSN != "amqp://orders" || cfg.Orders.Exchange != "events" {
+		t.Errorf("unexpected orders config %+v", cfg.Orders)
+	}
+	if cfg.Mails.DSN != "amqp://mails" || cfg.Mails.Exchange != "mail" {
+		t.Errorf("unexpected mails config %+v", cfg.Mails)
+	}
+}
+
 // 2. test load yaml from file
 // 3. test load env variables
 // 4. test override configuration env over yaml
@@ -30,43 +30,54 @@ func (d errbitNotificator) Notify(err interface{}, r *http.Request) {
 	}
 
 	n := d.Notifier.Notice(err, r, 0)
-	if e, ok := err.(errors.StackTracer); ok {
-		frames := make([]gobrake.StackFrame, 0, len(e.StackTrace()))
-		stackTrace := e.StackTrace()
-		var pcs []uintptr
-		for _, f := range stackTrace {
-			pcs = append(pcs, uintptr(f))
-		}
+	SetBacktrace(n, err)
+	Send(d.Notifier, n)
+}
 
-		ff := runtime.CallersFrames(pcs)
-		var firstPkg string
+// SetBacktrace replaces the notice backtrace with the stack of errors.StackTracer errors
+func SetBacktrace(n *gobrake.Notice, err interface{}) {
+	e, ok := err.(errors.StackTracer)
+	if !ok {
+		return
+	}
+	frames := make([]gobrake.StackFrame, 0, len(e.StackTrace()))
+	stackTrace := e.StackTrace()
+	var pcs []uintptr
+	for _, f := range stackTrace {
+		pcs = append(pcs, uintptr(f))
+	}
 
-		for {
-			f, ok := ff.Next()
-			if !ok {
-				break
-			}
+	ff := runtime.CallersFrames(pcs)
+	var firstPkg string
 
-			pkg, fn := splitPackageFuncName(f.Function)
-			if firstPkg == "" {
-				firstPkg = pkg
-			}
+	for {
+		f, ok := ff.Next()
+		if !ok {
+			break
+		}
 
-			frames = append(frames, gobrake.StackFrame{
-				File: f.File,
-				Line: f.Line,
-				Func: fn,
-			})
+		pkg, fn := splitPackageFuncName(f.Function)
+		if firstPkg == "" {
+			firstPkg = pkg
 		}
-		n.Errors[0].Backtrace = frames
-		n.Context["component"] = firstPkg
+
+		frames = append(frames, gobrake.StackFrame{
+			File: f.File,
+			Line: f.Line,
+			Func: fn,
+		})
 	}
+	n.Errors[0].Backtrace = frames
+	n.Context["component"] = firstPkg
+}
 
+// Send sends the notice asynchronously in production and waits for the result otherwise
+func Send(notifier *gobrake.Notifier, n *gobrake.Notice) {
 	if os.Getenv("ENV") == "production" {
-		d.Notifier.SendNoticeAsync(n)
+		notifier.SendNoticeAsync(n)
 		return
 	}
-	res, err1 := d.Notifier.SendNotice(n)
+	res, err1 := notifier.SendNotice(n)
 	log.Debugf("notify res = %s", res)
 	log.Tracef("notify message %#v", n)
 	if err1 != nil {
@@ -75,6 +86,13 @@ func (d errbitNotificator) Notify(err interface{}, r *http.Request) {
 }
 
 func NewErrbitNotificator(ErrbitProjectId int64, ErrbitProjectKey, ErrbitHost, env, proxy string) Notificator {
+	return &errbitNotificator{
+		Notifier: NewErrbitNotifier(ErrbitProjectId, ErrbitProjectKey, ErrbitHost, env, proxy),
+	}
+}
+
+// NewErrbitNotifier creates the gobrake notifier used by NewErrbitNotificator and rmqx/notificator
+func NewErrbitNotifier(ErrbitProjectId int64, ErrbitProjectKey, ErrbitHost, env, proxy string) *gobrake.Notifier {
 
 	configNotificator := &gobrake.NotifierOptions{
 		ProjectId:                 ErrbitProjectId,
@@ -106,10 +124,9 @@ func NewErrbitNotificator(ErrbitProjectId int64, ErrbitProjectKey, ErrbitHost, e
 		configNotificator.HTTPClient = &client
 	}
 	log.Debugf("configNotificator: %+v", configNotificator)
-	return &errbitNotificator{
-		Notifier: gobrake.NewNotifierWithOptions(configNotificator),
-	}
+	return gobrake.NewNotifierWithOptions(configNotificator)
 }
+
 func splitPackageFuncName(funcName string) (string, string) {
 	var packageName string
 	if ind := strings.LastIndex(funcName, "/"); ind > 0 {
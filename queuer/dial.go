@@ -0,0 +1,37 @@
+package queuer
+
+import (
+	"github.com/C0nstantin/pkg/transport/rabbitmq/dial"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TLSOptions configures TLS of amqps:// connections, client certificate files enable mTLS
+type TLSOptions = dial.TLSOptions
+
+// CredentialsProvider returns the user name and password for a new connection,
+// it is called on every dial, so passwords can be rotated without restart
+type CredentialsProvider = dial.CredentialsProvider
+
+// CredentialsFunc adapts a function to the CredentialsProvider interface
+type CredentialsFunc = dial.CredentialsFunc
+
+// FileCredentials reads the password from a file, like a mounted secret, on every dial
+type FileCredentials = dial.FileCredentials
+
+// Dial connects to the broker with the TLS options and credentials of the config,
+// with several nodes in DSN it tries them in NodeSelection order until one accepts the connection
+func (c *Config) Dial() (*amqp.Connection, error) {
+	conn, _, err := dial.SharedNodes(c.DSN).Connect(c.NodeSelection, &c.TLS, c.credentials())
+	return conn, err
+}
+
+// credentials returns Credentials or FileCredentials for PasswordFile with the user of the DSN
+func (c *Config) credentials() CredentialsProvider {
+	if c.Credentials != nil {
+		return c.Credentials
+	}
+	if c.PasswordFile == "" {
+		return nil
+	}
+	return dial.NewFileCredentials(c.DSN, c.PasswordFile)
+}
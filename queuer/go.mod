@@ -3,6 +3,7 @@ module github.com/C0nstantin/pkg/queuer
 go 1.19
 
 require (
+	github.com/C0nstantin/pkg/transport/rabbitmq/dial v0.1.0
 	github.com/imdario/mergo v0.3.15
 	github.com/pkg/errors v0.9.1
 	github.com/rabbitmq/amqp091-go v1.9.0
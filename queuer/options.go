@@ -8,11 +8,25 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// Config of a worker or publisher, it loads from YAML and env with config.LoadConfig like rmqx.Config,
+// the env-prefix tag of the parent field configures several workers of one binary independently:
+//
+//	type AppConfig struct {
+//		Orders queuer.Config `yaml:"orders" env-prefix:"ORDERS_"`
+//		Mails  queuer.Config `yaml:"mails" env-prefix:"MAILS_"`
+//	}
 type Config struct {
-	DSN             string
-	Exchange        string
-	RoutKey         string
-	QueName         string
+	// DSN may list several nodes of a cluster separated by commas, they are tried in NodeSelection order
+	DSN           string        `yaml:"dsn" env:"RABBITMQ_DSN" env-required:"true"`
+	NodeSelection NodeSelection `yaml:"node_selection" env:"RABBITMQ_NODE_SELECTION" env-default:"round-robin"`
+	// PasswordFile is read on every dial instead of the DSN password, so it can be rotated
+	PasswordFile string `yaml:"password_file" env:"RABBITMQ_PASSWORD_FILE"`
+	// Credentials overrides the DSN user and password and PasswordFile
+	Credentials     CredentialsProvider `yaml:"-"`
+	TLS             TLSOptions          `yaml:"tls"`
+	Exchange        string              `yaml:"exchange" env:"RABBITMQ_EXCHANGE,EX_NAME" env-default:""`
+	RoutKey         string              `yaml:"routing_key" env:"RABBITMQ_ROUTING_KEY" env-default:""`
+	QueName         string              `yaml:"que_name" env:"RABBITMQ_QUEUE_NAME" env-default:""`
 	ExchangeOptions ExchangeOptions
 	PublishOptions  PublishOptions
 	QueueOptions    QueueOptions
@@ -20,37 +34,38 @@ type Config struct {
 }
 
 type ExchangeOptions struct {
-	Kind       string
-	Durable    bool
-	AutoDelete bool
-	Internal   bool
-	NoWait     bool
-	Args       amqp.Table
+	Kind       string     `yaml:"kind" env:"RABBITMQ_EXCHANGE_KIND" env-default:"direct"`
+	Durable    bool       `yaml:"durable" env:"RABBITMQ_EXCHANGE_DURABLE" env-default:"true"`
+	AutoDelete bool       `yaml:"auto_delete" env:"RABBITMQ_EXCHANGE_AUTO_DELETE" env-default:"false"`
+	Internal   bool       `yaml:"internal" env:"RABBITMQ_EXCHANGE_INTERNAL" env-default:"false"`
+	NoWait     bool       `yaml:"nowait" env:"RABBITMQ_EXCHANGE_NOWAIT" env-default:"false"`
+	Args       amqp.Table `yaml:"args" env:"RABBITMQ_EXCHANGE_ARGS"`
 }
 
 type PublishOptions struct {
-	Mandatory bool
-	Immediate bool
+	Mandatory bool `yaml:"mandatory" env:"RABBITMQ_EXCHANGE_MANDATORY" env-default:"false"`
+	Immediate bool `yaml:"immediate" env:"RABBITMQ_EXCHANGE_IMMEDIATE" env-default:"false"`
 }
 
 type QueueOptions struct {
-	Durable    bool
-	AutoDelete bool
-	Exclusive  bool
-	NoWait     bool
-	Args       amqp.Table
+	Durable    bool       `yaml:"durable" env:"RABBITMQ_QUEUE_DURABLE" env-default:"true"`
+	AutoDelete bool       `yaml:"auto_delete" env:"RABBITMQ_QUEUE_DELETE" env-default:"false"`
+	Exclusive  bool       `yaml:"exclusive" env:"RABBITMQ_QUEUE_EXCLUSIVE" env-default:"false"`
+	NoWait     bool       `yaml:"nowait" env:"RABBITMQ_QUEUE_NOWAIT" env-default:"false"`
+	Args       amqp.Table `yaml:"args" env:"RABBITMQ_QUEUE_ARGS"`
 }
 
 type ConsumeOptions struct {
-	AutoAck   bool
-	Exclusive bool
-	NoLocal   bool
-	NoWait    bool
-	Args      amqp.Table
+	AutoAck   bool       `yaml:"auto_ack" env:"RABBITMQ_CONSUME_AUTO_ACK" env-default:"false"`
+	Exclusive bool       `yaml:"exclusive" env:"RABBITMQ_CONSUME_EXCLUSIVE" env-default:"false"`
+	NoLocal   bool       `yaml:"noLocal" env:"RABBITMQ_CONSUME_NO_LOCAL" env-default:"false"`
+	NoWait    bool       `yaml:"nowait" env:"RABBITMQ_CONSUME_NOWAIT" env-default:"false"`
+	Args      amqp.Table `yaml:"args" env:"RABBITMQ_CONSUME_ARGS"`
 }
 
 var ConfigDefaults = &Config{
 	DSN:             "",
+	NodeSelection:   NodeRoundRobin,
 	Exchange:        "",
 	RoutKey:         "",
 	QueName:         "",
@@ -17,9 +17,9 @@ func PublishMessage(c Config, publishing *amqp.Publishing) error {
 	if err != nil {
 		return err
 	}
-	conn, err := amqp.Dial(c.DSN)
+	conn, err := c.Dial()
 	if err != nil {
-		return fmt.Errorf("PushMessage connect to %s return error:  %w", c.DSN, err)
+		return fmt.Errorf("PushMessage %w", err)
 	}
 	defer func(conn *amqp.Connection) {
 		err := conn.Close()
@@ -1,8 +1,8 @@
 package queuer
 
 import (
-	"log"
-	"time"
+	"context"
+	"fmt"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -14,8 +14,9 @@ import (
 // times(header repeat_number).
 //
 // After times for repeat will be > MaxRepeat message put to queue with postfix .fail
-
-func StartRepeatableWorker(conf *Config, handler WorkerHandler, TTLBase int32, TTLRang int32, maxRepeat int32) {
+//
+// StartRepeatableWorker runs until ctx is done and returns the error which stopped the worker
+func StartRepeatableWorker(ctx context.Context, conf *Config, handler WorkerHandler, TTLBase int32, TTLRang int32, maxRepeat int32) error {
 	rejector := &RepeatableRejector{
 		TTLBase:   TTLBase,
 		TTLRang:   TTLRang,
@@ -24,12 +25,12 @@ func StartRepeatableWorker(conf *Config, handler WorkerHandler, TTLBase int32, T
 	}
 
 	if len(conf.Exchange) == 0 || len(conf.QueName) == 0 || len(conf.RoutKey) == 0 {
-		log.Fatalf("Invalid config for repeating")
+		return fmt.Errorf("invalid config for repeating: exchange, queue name and routing key are required")
 	}
 
 	worker, err := NewWorker(conf, handler, rejector)
 	if err != nil {
-		log.Fatalf("Repitable worker return error when create new worker: %v ", err)
+		return fmt.Errorf("create worker error: %w", err)
 	}
 
 	err = worker.channel.ExchangeDeclare(
@@ -41,7 +42,8 @@ func StartRepeatableWorker(conf *Config, handler WorkerHandler, TTLBase int32, T
 		conf.ExchangeOptions.NoWait,
 		conf.ExchangeOptions.Args)
 	if err != nil {
-		log.Fatalf("NewWorker amqp declare exchanger %s error: %s", conf.Exchange+".topic", err)
+		worker.Stop()
+		return fmt.Errorf("declare exchanger %s error: %w", conf.Exchange+".topic", err)
 	}
 
 	for _, postfix := range []string{".wait", ".fail"} { // declaration retry exchange
@@ -63,31 +65,15 @@ func StartRepeatableWorker(conf *Config, handler WorkerHandler, TTLBase int32, T
 			conf.QueueOptions.NoWait,
 			Args)
 		if err != nil {
-			log.Fatalf("can't declare queue %s: %s", queName, err)
+			worker.Stop()
+			return fmt.Errorf("declare queue %s error: %w", queName, err)
 		}
 		err = worker.channel.QueueBind(queName, conf.RoutKey+postfix, conf.Exchange+".topic", false, nil)
 		if err != nil {
-			log.Fatalf("Repitable worker return error when bind retry que: %v ", err)
-		}
-	}
-
-	go worker.Run()
-
-	for {
-		select {
-		case err := <-worker.Fatal:
 			worker.Stop()
-			log.Println("Sleep to 5 second before fail")
-			time.Sleep(5 * time.Second)
-			log.Fatalf("Fatal error:  %s", err)
-		case err := <-worker.Errors:
-			log.Printf("Worker return Error %s", err)
-		case done := <-worker.Done:
-			var requestId string
-			if r, ok := done.Headers["X-Request-Id"]; ok {
-				requestId = r.(string)
-			}
-			log.Println("Done : " + requestId)
+			return fmt.Errorf("bind queue %s error: %w", conf.QueName+postfix, err)
 		}
 	}
+
+	return serve(ctx, worker)
 }
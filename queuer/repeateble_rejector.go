@@ -39,6 +39,10 @@ func (r RepeatableRejector) Reject(delivery *amqp.Delivery) error {
 
 	err := PublishMessage(Config{
 		DSN:             r.Cnf.DSN,
+		NodeSelection:   r.Cnf.NodeSelection,
+		PasswordFile:    r.Cnf.PasswordFile,
+		Credentials:     r.Cnf.Credentials,
+		TLS:             r.Cnf.TLS,
 		Exchange:        delivery.Exchange + ".topic",
 		RoutKey:         delivery.RoutingKey + que,
 		ExchangeOptions: r.Cnf.ExchangeOptions,
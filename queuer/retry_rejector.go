@@ -22,6 +22,10 @@ func (r *RetryRejector) Reject(delivery *amqp.Delivery) error {
 	if currentRepeat+1 >= r.MaxRetry {
 		err := PublishMessage(Config{
 			DSN:             r.Cnf.DSN,
+			NodeSelection:   r.Cnf.NodeSelection,
+			PasswordFile:    r.Cnf.PasswordFile,
+			Credentials:     r.Cnf.Credentials,
+			TLS:             r.Cnf.TLS,
 			Exchange:        delivery.Exchange + ".topic",
 			RoutKey:         delivery.RoutingKey + ".fail",
 			ExchangeOptions: r.Cnf.ExchangeOptions,
@@ -1,8 +1,8 @@
 package queuer
 
 import (
-	"log"
-	"time"
+	"context"
+	"fmt"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -12,14 +12,15 @@ import (
 // rejector put this message to queue ("{{base_queue}}.retry") with ttl = params TTL second, and when ttl is over resend
 // message to base exchange with base route key
 // after MaxRetry fail times put message to queue with name "{{base_queue}}.fail"
-func StartRetryWorker(conf *Config, handler WorkerHandler, TTL, MaxRetry int32) {
+// it runs until ctx is done and returns the error which stopped the worker
+func StartRetryWorker(ctx context.Context, conf *Config, handler WorkerHandler, TTL, MaxRetry int32) error {
 	rejector := &RetryRejector{
 		MaxRetry: MaxRetry,
 		Cnf:      conf,
 	}
 
 	if len(conf.Exchange) == 0 || len(conf.QueName) == 0 || len(conf.RoutKey) == 0 {
-		log.Fatalf("Invalid config for repeating")
+		return fmt.Errorf("invalid config for repeating: exchange, queue name and routing key are required")
 	}
 
 	Args := amqp.Table{
@@ -32,7 +33,7 @@ func StartRetryWorker(conf *Config, handler WorkerHandler, TTL, MaxRetry int32)
 	worker, err := NewWorker(conf, handler, rejector)
 
 	if err != nil {
-		log.Fatalf("Repitable worker return error when create new worker: %v ", err)
+		return fmt.Errorf("create worker error: %w", err)
 	}
 	err = worker.channel.ExchangeDeclare(
 		conf.Exchange+".topic",
@@ -43,7 +44,8 @@ func StartRetryWorker(conf *Config, handler WorkerHandler, TTL, MaxRetry int32)
 		conf.ExchangeOptions.NoWait,
 		conf.ExchangeOptions.Args)
 	if err != nil {
-		log.Fatalf("NewWorker amqp declare exchanger %s error: %s", conf.Exchange+".topic", err)
+		worker.Stop()
+		return fmt.Errorf("declare exchanger %s error: %w", conf.Exchange+".topic", err)
 	}
 
 	for _, postfix := range []string{".retry", ".fail"} {
@@ -65,31 +67,15 @@ func StartRetryWorker(conf *Config, handler WorkerHandler, TTL, MaxRetry int32)
 			conf.QueueOptions.NoWait,
 			Args)
 		if err != nil {
-			log.Fatalf("Error after declarate que retry: %v", err)
+			worker.Stop()
+			return fmt.Errorf("declare queue %s error: %w", conf.QueName+postfix, err)
 		}
 		err = worker.channel.QueueBind(conf.QueName+postfix, conf.RoutKey+postfix, conf.Exchange+".topic", false, nil)
 		if err != nil {
-			log.Fatalf("Repitable worker return error when bind retry que: %v ", err)
-		}
-	}
-
-	go worker.Run()
-
-	for {
-		select {
-		case err := <-worker.Fatal:
 			worker.Stop()
-			log.Println("Sleep to 5 second before fail")
-			time.Sleep(5 * time.Second)
-			log.Fatalf("Fatal error:  %s", err)
-		case err := <-worker.Errors:
-			log.Printf("Worker return Error %s", err)
-		case done := <-worker.Done:
-			var requestId string
-			if r, ok := done.Headers["X-Request-Id"]; ok {
-				requestId = r.(string)
-			}
-			log.Println("Done : " + requestId)
+			return fmt.Errorf("bind queue %s error: %w", conf.QueName+postfix, err)
 		}
 	}
+
+	return serve(ctx, worker)
 }
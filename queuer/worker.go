@@ -0,0 +1,219 @@
+package queuer
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Worker consumes the queue of the config with one channel,
+// results of the handler are reported to Done, Errors and Fatal
+type Worker struct {
+	config   *Config
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	handler  WorkerHandler
+	rejector WorkerRejector
+
+	Fatal  chan error          // the worker stopped consuming, it must be stopped
+	Errors chan error          // the handler failed, the message is passed to the rejector
+	Done   chan *amqp.Delivery // the message is handled and acked
+}
+
+// NewWorker connects to the broker and declares the exchange, the queue and the binding of the config,
+// rejector is called for messages the handler failed, nil rejects them without requeue
+func NewWorker(c *Config, handler WorkerHandler, rejector WorkerRejector) (*Worker, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("handler must be not nil")
+	}
+	if rejector == nil {
+		rejector = &EmptyRejector{}
+	}
+	if err := c.MergeDefaults(); err != nil {
+		return nil, err
+	}
+	conn, err := c.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("NewWorker %w", err)
+	}
+	w := &Worker{
+		config:   c,
+		conn:     conn,
+		handler:  handler,
+		rejector: rejector,
+		Fatal:    make(chan error, 1),
+		Errors:   make(chan error),
+		Done:     make(chan *amqp.Delivery),
+	}
+	if err := w.declare(); err != nil {
+		w.Stop()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Worker) declare() error {
+	c := w.config
+	ch, err := w.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("NewWorker create Channel error: %w", err)
+	}
+	w.channel = ch
+	if err := ch.Qos(1, 0, false); err != nil {
+		return fmt.Errorf("NewWorker set qos error: %w", err)
+	}
+	if c.Exchange != "" {
+		err = ch.ExchangeDeclare(c.Exchange,
+			c.ExchangeOptions.Kind,
+			c.ExchangeOptions.Durable,
+			c.ExchangeOptions.AutoDelete,
+			c.ExchangeOptions.Internal,
+			c.ExchangeOptions.NoWait,
+			c.ExchangeOptions.Args)
+		if err != nil {
+			return fmt.Errorf("NewWorker amqp declare exchanger %s error: %w", c.Exchange, err)
+		}
+	}
+	_, err = ch.QueueDeclare(c.QueName,
+		c.QueueOptions.Durable,
+		c.QueueOptions.AutoDelete,
+		c.QueueOptions.Exclusive,
+		c.QueueOptions.NoWait,
+		c.QueueOptions.Args)
+	if err != nil {
+		return fmt.Errorf("NewWorker declare queue %s error: %w", c.QueName, err)
+	}
+	if c.Exchange != "" {
+		err = ch.QueueBind(c.QueName, c.RoutKey, c.Exchange, false, nil)
+		if err != nil {
+			return fmt.Errorf("NewWorker bind queue %s to %s error: %w", c.QueName, c.Exchange, err)
+		}
+	}
+	return nil
+}
+
+// Run consumes messages until ctx is done or a fatal error is sent to Fatal
+func (w *Worker) Run(ctx context.Context) {
+	closeConn := w.conn.NotifyClose(make(chan *amqp.Error, 1))
+	closeChan := w.channel.NotifyClose(make(chan *amqp.Error, 1))
+	c := w.config
+	msgs, err := w.channel.Consume(c.QueName, "",
+		c.ConsumeOptions.AutoAck,
+		c.ConsumeOptions.Exclusive,
+		c.ConsumeOptions.NoLocal,
+		c.ConsumeOptions.NoWait,
+		c.ConsumeOptions.Args)
+	if err != nil {
+		w.fatal(ctx, fmt.Errorf("consume queue %s error: %w", c.QueName, err))
+		return
+	}
+	log.Printf("Start consume que %s, exchange %s, routing key %s", c.QueName, c.Exchange, c.RoutKey)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-closeConn:
+			if err != nil { // nil - closed by Stop
+				w.fatal(ctx, fmt.Errorf("%w %s", ErrConnectionClosed, err))
+			}
+			return
+		case err := <-closeChan:
+			if err != nil {
+				w.fatal(ctx, fmt.Errorf("%w %s", ErrChanelClosed, err))
+			}
+			return
+		case d, ok := <-msgs:
+			if !ok {
+				w.fatal(ctx, fmt.Errorf("consumer of queue %s is canceled", c.QueName))
+				return
+			}
+			if err := w.handle(ctx, &d); err != nil {
+				w.fatal(ctx, err)
+				return
+			}
+		}
+	}
+}
+
+// handle passes the message to the handler, a failed message to the rejector,
+// the returned error is fatal
+func (w *Worker) handle(ctx context.Context, d *amqp.Delivery) error {
+	if err := w.safeHandle(d); err != nil {
+		select {
+		case w.Errors <- err:
+		case <-ctx.Done():
+		}
+		if err := w.rejector.Reject(d); err != nil {
+			return fmt.Errorf("reject message error: %w", err)
+		}
+		return nil
+	}
+	if !w.config.ConsumeOptions.AutoAck {
+		if err := d.Ack(false); err != nil {
+			return fmt.Errorf("ack message error: %w", err)
+		}
+	}
+	select {
+	case w.Done <- d:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// safeHandle returns a panic of the handler as an error
+func (w *Worker) safeHandle(d *amqp.Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return w.handler.Handle(d)
+}
+
+func (w *Worker) fatal(ctx context.Context, err error) {
+	select {
+	case w.Fatal <- err:
+	case <-ctx.Done():
+	}
+}
+
+// Stop closes the channel and the connection of the worker
+func (w *Worker) Stop() {
+	if w.channel != nil && !w.channel.IsClosed() {
+		if err := w.channel.Close(); err != nil {
+			log.Printf("cannot close channel error: %s", err)
+		}
+	}
+	if !w.conn.IsClosed() {
+		if err := w.conn.Close(); err != nil {
+			log.Printf("can not close connection err = %s", err)
+		}
+	}
+}
+
+// serve runs the worker until ctx is done or a fatal error, Errors and Done are logged
+func serve(ctx context.Context, worker *Worker) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go worker.Run(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			worker.Stop()
+			return nil
+		case err := <-worker.Fatal:
+			worker.Stop()
+			return fmt.Errorf("worker fatal error: %w", err)
+		case err := <-worker.Errors:
+			log.Printf("Worker return Error %s", err)
+		case done := <-worker.Done:
+			var requestId string
+			if r, ok := done.Headers["X-Request-Id"].(string); ok {
+				requestId = r
+			}
+			log.Println("Done : " + requestId)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package queuer
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type testAcknowledger struct {
+	acked, rejected int
+}
+
+func (a *testAcknowledger) Ack(uint64, bool) error {
+	a.acked++
+	return nil
+}
+
+func (a *testAcknowledger) Nack(uint64, bool, bool) error {
+	return nil
+}
+
+func (a *testAcknowledger) Reject(uint64, bool) error {
+	a.rejected++
+	return nil
+}
+
+func TestWorker_handle(t *testing.T) {
+	handler := &WorkerTestHandler{
+		ResChan: make(chan *amqp.Delivery, 3),
+		ErrChan: make(chan *amqp.Delivery, 3),
+	}
+	rejector := &WorkerTestRejector{ResChan: make(chan *amqp.Delivery, 3)}
+	w := &Worker{
+		config:   &Config{},
+		handler:  handler,
+		rejector: rejector,
+		Errors:   make(chan error, 3),
+		Done:     make(chan *amqp.Delivery, 3),
+	}
+	ctx := context.Background()
+	ack := &testAcknowledger{}
+
+	for _, body := range []string{"OK", "ERROR", "PANIC"} {
+		err := w.handle(ctx, &amqp.Delivery{Acknowledger: ack, Body: []byte(body)})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, ack.acked)
+	assert.Equal(t, []string{"OK"}, handler.Res)
+	assert.Equal(t, []string{"ERROR", "PANIC"}, rejector.Res)
+	assert.Len(t, w.Done, 1)
+	assert.Len(t, w.Errors, 2)
+}
+
+func TestStartSimpleWorker_dialError(t *testing.T) {
+	err := StartSimpleWorker(context.Background(), &Config{DSN: "amqp://127.0.0.1:1/"}, &EmptyWorkerHandeler{}, nil)
+	assert.Error(t, err)
+}
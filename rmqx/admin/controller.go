@@ -0,0 +1,191 @@
+// Package admin contains an HTTP controller managing fail queues of rmqx retry and repeat pools,
+// it implements serve.Controller and can be mounted on serve.HTTPServe.
+package admin
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/rmqx"
+	"github.com/C0nstantin/pkg/serve"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrQueueNotFound = errors.New("fail queue not found")
+	// ErrNoSelection is returned when a requeue or purge request selects neither ids nor all messages
+	ErrNoSelection = errors.New(`select messages with "ids" or every message with "all": true`)
+)
+
+// FailQueue is the part of rmqx.FailQueueAdmin used by the controller
+type FailQueue interface {
+	Name() string
+	Count() (int, error)
+	List(limit int) ([]rmqx.FailedMessage, error)
+	Requeue(ctx context.Context, ids []string) (int, error)
+	Edit(ctx context.Context, id string, edit rmqx.MessageEdit) error
+	Purge(ids []string) (int, error)
+}
+
+// Controller serves:
+//
+//	GET    /queues                            fail queues with message counts
+//	GET    /queues/:queue/messages?limit=N    messages with headers and x-death history
+//	POST   /queues/:queue/requeue             {"ids": [...]} requeue selected or, with {"all": true}, all messages
+//	POST   /queues/:queue/messages/:id/requeue rmqx.MessageEdit, edit and requeue one message
+//	DELETE /queues/:queue/messages            {"ids": [...]} remove selected or, with {"all": true}, all messages
+//
+// A requeue or purge request without a selection fails with ErrNoSelection as a bind error.
+//
+// Errors are passed to ctx.Error, so serve.DefaultErrorHandler renders them,
+// add ErrQueueNotFound and rmqx.ErrMessageNotFound to its NotFoundErrorErrors.
+type Controller struct {
+	serve.BaseController
+	// Auth and Middlewares protect the routes, see serve.Protect
+	Auth        serve.Auth
+	Middlewares []gin.HandlerFunc
+	// DefaultLimit is the number of listed messages when the request has no limit
+	DefaultLimit int
+
+	queues map[string]FailQueue
+}
+
+func NewController(queues ...FailQueue) *Controller {
+	c := &Controller{queues: map[string]FailQueue{}, DefaultLimit: 100}
+	for _, q := range queues {
+		c.queues[q.Name()] = q
+	}
+	return c
+}
+
+func (c *Controller) InitRoute(routes gin.IRoutes, path string) {
+	routes = serve.Protect(routes, c.Auth, c.Middlewares...)
+	c.GET(routes, path+"/queues", c.listQueues)
+	c.GET(routes, path+"/queues/:queue/messages", c.listMessages)
+	c.POST(routes, path+"/queues/:queue/requeue", c.requeue)
+	c.POST(routes, path+"/queues/:queue/messages/:id/requeue", c.edit)
+	c.DELETE(routes, path+"/queues/:queue/messages", c.purge)
+}
+
+type queueInfo struct {
+	Name     string `json:"name"`
+	Messages int    `json:"messages"`
+}
+
+type selection struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all"`
+}
+
+// bindSelection returns the selected ids, nil when all messages are selected explicitly
+func bindSelection(ctx *gin.Context) ([]string, error) {
+	var req selection
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return nil, bindError(errors.Errorf("%v: %v", ErrNoSelection, err))
+	}
+	if req.All == (len(req.IDs) > 0) {
+		return nil, bindError(ErrNoSelection)
+	}
+	return req.IDs, nil
+}
+
+func (c *Controller) listQueues(ctx *gin.Context) error {
+	res := make([]queueInfo, 0, len(c.queues))
+	for name, q := range c.queues {
+		count, err := q.Count()
+		if err != nil {
+			return err
+		}
+		res = append(res, queueInfo{Name: name, Messages: count})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	ctx.JSON(http.StatusOK, res)
+	return nil
+}
+
+func (c *Controller) listMessages(ctx *gin.Context) error {
+	q, err := c.queue(ctx)
+	if err != nil {
+		return err
+	}
+	limit := c.DefaultLimit
+	if l := ctx.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			return bindError(errors.Errorf("invalid limit %q", l))
+		}
+	}
+	messages, err := q.List(limit)
+	if err != nil {
+		return err
+	}
+	ctx.JSON(http.StatusOK, messages)
+	return nil
+}
+
+func (c *Controller) requeue(ctx *gin.Context) error {
+	q, err := c.queue(ctx)
+	if err != nil {
+		return err
+	}
+	ids, err := bindSelection(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := q.Requeue(ctx, ids)
+	if err != nil {
+		return err
+	}
+	ctx.JSON(http.StatusOK, gin.H{"requeued": n})
+	return nil
+}
+
+func (c *Controller) edit(ctx *gin.Context) error {
+	q, err := c.queue(ctx)
+	if err != nil {
+		return err
+	}
+	var edit rmqx.MessageEdit
+	if err := ctx.ShouldBindJSON(&edit); err != nil {
+		return bindError(err)
+	}
+	if err := q.Edit(ctx, ctx.Param("id"), edit); err != nil {
+		return err
+	}
+	ctx.JSON(http.StatusOK, gin.H{"requeued": 1})
+	return nil
+}
+
+func (c *Controller) purge(ctx *gin.Context) error {
+	q, err := c.queue(ctx)
+	if err != nil {
+		return err
+	}
+	ids, err := bindSelection(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := q.Purge(ids)
+	if err != nil {
+		return err
+	}
+	ctx.JSON(http.StatusOK, gin.H{"removed": n})
+	return nil
+}
+
+func (c *Controller) queue(ctx *gin.Context) (FailQueue, error) {
+	name := ctx.Param("queue")
+	q, ok := c.queues[name]
+	if !ok {
+		return nil, errors.Errorf("%v: %s", ErrQueueNotFound, name)
+	}
+	return q, nil
+}
+
+// bindError makes serve.DefaultErrorHandler respond with 400
+func bindError(err error) error {
+	return &gin.Error{Err: err, Type: gin.ErrorTypeBind}
+}
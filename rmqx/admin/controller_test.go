@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/C0nstantin/pkg/rmqx"
+	"github.com/gin-gonic/gin"
+)
+
+type fakeQueue struct {
+	requeued []string
+	requeues int
+	purges   int
+	edited   rmqx.MessageEdit
+}
+
+func (f *fakeQueue) Name() string        { return "billing.fail" }
+func (f *fakeQueue) Count() (int, error) { return 2, nil }
+func (f *fakeQueue) List(limit int) ([]rmqx.FailedMessage, error) {
+	return []rmqx.FailedMessage{{ID: "1"}, {ID: "2"}}[:limit], nil
+}
+func (f *fakeQueue) Requeue(_ context.Context, ids []string) (int, error) {
+	f.requeued = ids
+	f.requeues++
+	return len(ids), nil
+}
+func (f *fakeQueue) Edit(_ context.Context, id string, edit rmqx.MessageEdit) error {
+	f.edited = edit
+	return nil
+}
+func (f *fakeQueue) Purge(ids []string) (int, error) {
+	f.purges++
+	return 2, nil
+}
+
+type denyAll struct{}
+
+func (denyAll) AuthMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) { ctx.AbortWithStatus(http.StatusUnauthorized) }
+}
+
+func TestController(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	q := &fakeQueue{}
+	r := gin.New()
+	r.Use(func(ctx *gin.Context) { // serve.DefaultErrorHandler responds to bind errors with 400
+		ctx.Next()
+		if ctx.Errors.ByType(gin.ErrorTypeBind).Last() != nil {
+			ctx.Status(http.StatusBadRequest)
+		}
+	})
+	NewController(q).InitRoute(r, "/admin")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/admin/queues/billing.fail/messages?limit=1", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":"1"`) || strings.Contains(w.Body.String(), `"id":"2"`) {
+		t.Errorf("unexpected list response %d %s", w.Code, w.Body)
+	}
+	w = do(http.MethodPost, "/admin/queues/billing.fail/requeue", `{"ids":["1","2"]}`)
+	if w.Code != http.StatusOK || len(q.requeued) != 2 {
+		t.Errorf("unexpected requeue response %d %s", w.Code, w.Body)
+	}
+	w = do(http.MethodPost, "/admin/queues/billing.fail/requeue", `{"all":true}`)
+	if w.Code != http.StatusOK || q.requeued != nil || q.requeues != 2 {
+		t.Errorf("unexpected requeue all response %d %s", w.Code, w.Body)
+	}
+	w = do(http.MethodPost, "/admin/queues/billing.fail/messages/1/requeue", `{"body":"fixed"}`)
+	if w.Code != http.StatusOK || q.edited.Body == nil || *q.edited.Body != "fixed" {
+		t.Errorf("unexpected edit response %d %s", w.Code, w.Body)
+	}
+
+	// every message is selected only explicitly
+	for _, body := range []string{"", "{}", `{"ids":[]}`, `{"all":false}`, `{"ids":["1"],"all":true}`} {
+		if w = do(http.MethodDelete, "/admin/queues/billing.fail/messages", body); w.Code != http.StatusBadRequest || q.purges != 0 {
+			t.Errorf("purge with %q must fail, got %d, %d purges", body, w.Code, q.purges)
+		}
+		if w = do(http.MethodPost, "/admin/queues/billing.fail/requeue", body); w.Code != http.StatusBadRequest || q.requeues != 2 {
+			t.Errorf("requeue with %q must fail, got %d", body, w.Code)
+		}
+	}
+	if w = do(http.MethodDelete, "/admin/queues/billing.fail/messages", `{"all":true}`); w.Code != http.StatusOK || q.purges != 1 {
+		t.Errorf("unexpected purge all response %d %s", w.Code, w.Body)
+	}
+
+	protected := gin.New()
+	c := NewController(q)
+	c.Auth = denyAll{}
+	c.InitRoute(protected, "/admin")
+	w = httptest.NewRecorder()
+	protected.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/queues", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("auth middleware must protect routes, got %d", w.Code)
+	}
+}
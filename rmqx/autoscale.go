@@ -0,0 +1,236 @@
+package rmqx
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AutoscaleOptions configures queue-depth driven scaling of a WorkerPool.
+//
+// Every CheckInterval the pool inspects its queue with a passive declare and measures
+// how busy the workers were since the previous check. When the backlog needs more than
+// the current workers and they are busy, the pool scales up to
+// ceil(messages / MessagesPerWorker) workers at once, so bursts drain fast.
+// When the backlog is small and the workers are mostly idle, it removes one worker per check.
+// The number of workers always stays between MinWorkers and MaxWorkers.
+type AutoscaleOptions struct {
+	MinWorkers           int           `yaml:"min_workers" env:"RABBITMQ_AUTOSCALE_MIN_WORKERS" env-default:"1"`
+	MaxWorkers           int           `yaml:"max_workers" env:"RABBITMQ_AUTOSCALE_MAX_WORKERS" env-default:"10"`
+	MessagesPerWorker    int           `yaml:"messages_per_worker" env:"RABBITMQ_AUTOSCALE_MESSAGES_PER_WORKER" env-default:"100"`
+	CheckInterval        time.Duration `yaml:"check_interval" env:"RABBITMQ_AUTOSCALE_CHECK_INTERVAL" env-default:"10s"`
+	ScaleUpCooldown      time.Duration `yaml:"scale_up_cooldown" env:"RABBITMQ_AUTOSCALE_SCALE_UP_COOLDOWN" env-default:"30s"`
+	ScaleDownCooldown    time.Duration `yaml:"scale_down_cooldown" env:"RABBITMQ_AUTOSCALE_SCALE_DOWN_COOLDOWN" env-default:"2m"`
+	ScaleUpUtilization   float64       `yaml:"scale_up_utilization" env:"RABBITMQ_AUTOSCALE_SCALE_UP_UTILIZATION" env-default:"0.8"`
+	ScaleDownUtilization float64       `yaml:"scale_down_utilization" env:"RABBITMQ_AUTOSCALE_SCALE_DOWN_UTILIZATION" env-default:"0.3"`
+}
+
+func (o AutoscaleOptions) validate() error {
+	if o.MinWorkers <= 0 {
+		return errors.New("autoscale min workers must be greater than 0")
+	}
+	if o.MaxWorkers < o.MinWorkers {
+		return errors.New("autoscale max workers must be not less than min workers")
+	}
+	if o.MessagesPerWorker <= 0 {
+		return errors.New("autoscale messages per worker must be greater than 0")
+	}
+	if o.CheckInterval <= 0 {
+		return errors.New("autoscale check interval must be greater than 0")
+	}
+	if o.ScaleDownUtilization > o.ScaleUpUtilization {
+		return errors.New("autoscale scale down utilization must be not greater than scale up utilization")
+	}
+	return nil
+}
+
+// desired returns the number of workers the pool should have for the observed queue state
+func (o AutoscaleOptions) desired(current, messages int, utilization float64) int {
+	target := current
+	backlog := (messages + o.MessagesPerWorker - 1) / o.MessagesPerWorker
+	switch {
+	case backlog > current && utilization >= o.ScaleUpUtilization:
+		target = backlog
+	case backlog < current && utilization <= o.ScaleDownUtilization:
+		target = current - 1
+	}
+	if target < o.MinWorkers {
+		target = o.MinWorkers
+	}
+	if target > o.MaxWorkers {
+		target = o.MaxWorkers
+	}
+	return target
+}
+
+// autoscaler applies cool-down periods on top of AutoscaleOptions.desired
+type autoscaler struct {
+	opts      AutoscaleOptions
+	lastUp    time.Time
+	lastScale time.Time
+}
+
+func (a *autoscaler) next(now time.Time, current, messages int, utilization float64) int {
+	target := a.opts.desired(current, messages, utilization)
+	switch {
+	case target > current && now.Sub(a.lastUp) >= a.opts.ScaleUpCooldown:
+		a.lastUp, a.lastScale = now, now
+		return target
+	case target < current && now.Sub(a.lastScale) >= a.opts.ScaleDownCooldown:
+		a.lastScale = now
+		return target
+	}
+	return current
+}
+
+// poolStats collects how much time the pool workers spend in the handler
+type poolStats struct {
+	inFlight  atomic.Int64
+	busyNanos atomic.Int64
+}
+
+// utilization returns the share of the elapsed time the workers were busy, from 0 to 1
+func (s *poolStats) utilization(busy, elapsed time.Duration, workers int) float64 {
+	if workers <= 0 || elapsed <= 0 {
+		return 0
+	}
+	u := float64(busy) / (float64(elapsed) * float64(workers))
+	// long running handlers are not counted in busy time until they finish
+	if f := float64(s.inFlight.Load()) / float64(workers); f > u {
+		u = f
+	}
+	if u > 1 {
+		u = 1
+	}
+	return u
+}
+
+type trackedHandler struct {
+	handler Handler
+	stats   *poolStats
+}
+
+func (t *trackedHandler) Handle(delivery *amqp.Delivery, logger log.Logger) error {
+	t.stats.inFlight.Add(1)
+	start := time.Now()
+	defer func() {
+		t.stats.busyNanos.Add(int64(time.Since(start)))
+		t.stats.inFlight.Add(-1)
+	}()
+	return t.handler.Handle(delivery, logger)
+}
+
+// EnableAutoscale switches the pool to autoscaling mode, the worker count passed to the pool
+// constructor is used as the initial one and is brought into the [MinWorkers, MaxWorkers] range.
+// It must be called before Start.
+func (p *WorkerPool) EnableAutoscale(opts AutoscaleOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.workers); n < opts.MinWorkers {
+		if err := p.addWorkers(opts.MinWorkers - n); err != nil {
+			return err
+		}
+	} else if n > opts.MaxWorkers {
+		p.workers = p.workers[:opts.MaxWorkers]
+	}
+	p.autoscale = &opts
+	return nil
+}
+
+// WorkerCount returns the number of currently running workers
+func (p *WorkerPool) WorkerCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.workers)
+}
+
+func (p *WorkerPool) runAutoscaler(ctx context.Context, errChan chan<- error) {
+	scaler := &autoscaler{opts: *p.autoscale, lastScale: time.Now()}
+	ticker := time.NewTicker(scaler.opts.CheckInterval)
+	defer ticker.Stop()
+
+	var ch *amqp.Channel
+	defer func() {
+		if ch != nil && !ch.IsClosed() {
+			_ = ch.Close()
+		}
+	}()
+	lastBusy, lastCheck := time.Duration(p.stats.busyNanos.Load()), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if ch == nil || ch.IsClosed() {
+				var err error
+				// a failed passive declare closes the channel, so it is reopened on the next check
+				p.mu.Lock()
+				conn := p.conn
+				p.mu.Unlock()
+				ch, err = conn.Channel()
+				if err != nil {
+					log.Errorf("autoscale: failed to open a channel: %s", err)
+					continue
+				}
+			}
+			q, err := ch.QueueDeclarePassive(
+				p.config.QueName,
+				p.config.QueueOptions.Durable,
+				p.config.QueueOptions.AutoDelete,
+				p.config.QueueOptions.Exclusive,
+				p.config.QueueOptions.NoWait,
+				p.config.QueueOptions.Args)
+			if err != nil {
+				log.Errorf("autoscale: failed to inspect queue %s: %s", p.config.QueName, err)
+				continue
+			}
+			busy := time.Duration(p.stats.busyNanos.Load())
+			current := p.WorkerCount()
+			utilization := p.stats.utilization(busy-lastBusy, now.Sub(lastCheck), current)
+			lastBusy, lastCheck = busy, now
+
+			target := scaler.next(now, current, q.Messages, utilization)
+			if target == current {
+				continue
+			}
+			log.Infof("autoscale: queue %s has %d messages, utilization %.2f, scaling workers %d -> %d",
+				p.config.QueName, q.Messages, utilization, current, target)
+			if err := p.resize(ctx, target, errChan); err != nil {
+				log.Errorf("autoscale: failed to resize pool: %s", err)
+			}
+		}
+	}
+}
+
+// resize starts or stops workers until the pool has target workers
+func (p *WorkerPool) resize(ctx context.Context, target int, errChan chan<- error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.workers) < target {
+		worker, err := p.spawn()
+		if err != nil {
+			return err
+		}
+		p.workers = append(p.workers, worker)
+		var cancel context.CancelFunc
+		if p.IsActive() {
+			cancel = p.runWorker(ctx, worker, errChan)
+		}
+		p.cancels = append(p.cancels, cancel)
+	}
+	for len(p.workers) > target {
+		last := len(p.workers) - 1
+		if p.cancels[last] != nil {
+			p.cancels[last]()
+		}
+		p.workers, p.cancels = p.workers[:last], p.cancels[:last]
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package rmqx
+
+import (
+	"testing"
+	"time"
+)
+
+var testAutoscaleOptions = AutoscaleOptions{
+	MinWorkers:           1,
+	MaxWorkers:           10,
+	MessagesPerWorker:    100,
+	CheckInterval:        time.Second,
+	ScaleUpCooldown:      30 * time.Second,
+	ScaleDownCooldown:    2 * time.Minute,
+	ScaleUpUtilization:   0.8,
+	ScaleDownUtilization: 0.3,
+}
+
+func TestAutoscaleOptions_desired(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     int
+		messages    int
+		utilization float64
+		want        int
+	}{
+		{"burst on busy workers", 2, 750, 1, 8},
+		{"burst is limited by max workers", 2, 5000, 1, 10},
+		{"backlog on idle workers", 2, 750, 0.1, 2},
+		{"idle queue", 5, 0, 0, 4},
+		{"idle queue keeps min workers", 1, 0, 0, 1},
+		{"steady load", 3, 250, 0.5, 3},
+		{"below min workers", 0, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testAutoscaleOptions.desired(tt.current, tt.messages, tt.utilization)
+			if got != tt.want {
+				t.Errorf("expected %d workers, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAutoscaler_cooldown(t *testing.T) {
+	start := time.Now()
+	a := &autoscaler{opts: testAutoscaleOptions, lastScale: start}
+
+	if got := a.next(start.Add(time.Second), 1, 500, 1); got != 5 {
+		t.Fatalf("expected scale up to 5, got %d", got)
+	}
+	if got := a.next(start.Add(10*time.Second), 5, 1000, 1); got != 5 {
+		t.Errorf("scale up during cooldown, got %d", got)
+	}
+	if got := a.next(start.Add(40*time.Second), 5, 1000, 1); got != 10 {
+		t.Errorf("expected scale up to 10 after cooldown, got %d", got)
+	}
+	if got := a.next(start.Add(time.Minute), 10, 0, 0); got != 10 {
+		t.Errorf("scale down during cooldown, got %d", got)
+	}
+	if got := a.next(start.Add(3*time.Minute), 10, 0, 0); got != 9 {
+		t.Errorf("expected scale down to 9 after cooldown, got %d", got)
+	}
+}
+
+func TestAutoscaleOptions_validate(t *testing.T) {
+	opts := testAutoscaleOptions
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	opts.MaxWorkers = 0
+	if err := opts.validate(); err == nil {
+		t.Error("expected error for max workers less than min workers")
+	}
+}
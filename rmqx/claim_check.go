@@ -0,0 +1,186 @@
+package rmqx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ClaimCheckHeader carries the blob store reference of an offloaded message body
+const ClaimCheckHeader = "x-claim-check"
+
+// BlobStore keeps message bodies too large to be sent through the broker
+type BlobStore interface {
+	Put(ctx context.Context, body []byte) (ref string, err error)
+	Get(ctx context.Context, ref string) ([]byte, error)
+	Delete(ctx context.Context, ref string) error
+}
+
+// CleanupPolicy defines when an offloaded body is removed from the store
+type CleanupPolicy int
+
+const (
+	// CleanupAfterAck deletes the body after the message is handled and acked
+	CleanupAfterAck CleanupPolicy = iota
+	// CleanupNever keeps the body, use it when the message is delivered to several queues
+	// or the store expires bodies by itself
+	CleanupNever
+)
+
+// ClaimCheck configures the claim-check pattern for a Config.
+// Publishing functions offload bodies larger than Threshold bytes into Store and send
+// an empty message with the ClaimCheckHeader, pool workers load the body back before
+// calling the handler.
+type ClaimCheck struct {
+	Store     BlobStore
+	Threshold int
+	Cleanup   CleanupPolicy
+}
+
+// offload returns a copy of publishing with the body moved to the store when it exceeds the threshold
+func (c *ClaimCheck) offload(ctx context.Context, publishing *amqp.Publishing) (*amqp.Publishing, error) {
+	if c == nil || c.Store == nil || len(publishing.Body) <= c.Threshold {
+		return publishing, nil
+	}
+	ref, err := c.Store.Put(ctx, publishing.Body)
+	if err != nil {
+		return nil, errors.Er(err, "claim check: failed to store message body")
+	}
+	p := *publishing
+	p.Headers = amqp.Table{}
+	for k, v := range publishing.Headers {
+		p.Headers[k] = v
+	}
+	p.Headers[ClaimCheckHeader] = ref
+	p.Body = nil
+	return &p, nil
+}
+
+// discard removes the offloaded body of a message which was not published
+func (c *ClaimCheck) discard(publishing *amqp.Publishing) {
+	if c == nil || c.Store == nil {
+		return
+	}
+	if ref, ok := publishing.Headers[ClaimCheckHeader].(string); ok && ref != "" {
+		if err := c.Store.Delete(context.Background(), ref); err != nil {
+			log.Errorf("claim check: failed to delete message body %s: %s", ref, err)
+		}
+	}
+}
+
+func claimRef(delivery *amqp.Delivery) (string, bool) {
+	ref, ok := delivery.Headers[ClaimCheckHeader].(string)
+	return ref, ok && ref != ""
+}
+
+// claimCheckHandler loads offloaded bodies before calling the wrapped handler
+type claimCheckHandler struct {
+	handler Handler
+	check   *ClaimCheck
+}
+
+func (c *claimCheckHandler) Handle(delivery *amqp.Delivery, logger log.Logger) error {
+	ref, ok := claimRef(delivery)
+	if !ok {
+		return c.handler.Handle(delivery, logger)
+	}
+	body, err := c.check.Store.Get(context.Background(), ref)
+	if err != nil {
+		return errors.Er(err, "claim check: failed to load message body %s", ref)
+	}
+	// rejectors republish the delivery, so it must keep the reference instead of the body
+	reference := delivery.Body
+	delivery.Body = body
+	defer func() { delivery.Body = reference }()
+	return c.handler.Handle(delivery, logger)
+}
+
+// acked is called by the worker after the message is acknowledged
+func (c *claimCheckHandler) acked(delivery *amqp.Delivery) {
+	if c.check.Cleanup != CleanupAfterAck {
+		return
+	}
+	if ref, ok := claimRef(delivery); ok {
+		if err := c.check.Store.Delete(context.Background(), ref); err != nil {
+			log.Errorf("claim check: failed to delete message body %s: %s", ref, err)
+		}
+	}
+}
+
+// ackObserver is implemented by handlers which need to know the message was acked
+type ackObserver interface {
+	acked(delivery *amqp.Delivery)
+}
+
+var fileRefPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// FileBlobStore keeps message bodies as files in Dir, the directory must be shared by publishers and consumers
+type FileBlobStore struct {
+	Dir string
+}
+
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.E(err)
+	}
+	return &FileBlobStore{Dir: dir}, nil
+}
+
+func (f *FileBlobStore) Put(_ context.Context, body []byte) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", errors.E(err)
+	}
+	ref := hex.EncodeToString(id)
+	tmp, err := os.CreateTemp(f.Dir, ref+".*.tmp")
+	if err != nil {
+		return "", errors.E(err)
+	}
+	if _, err = tmp.Write(body); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path(ref))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", errors.E(err)
+	}
+	return ref, nil
+}
+
+func (f *FileBlobStore) Get(_ context.Context, ref string) ([]byte, error) {
+	if !fileRefPattern.MatchString(ref) {
+		return nil, errors.Errorf("invalid blob reference %q", ref)
+	}
+	body, err := os.ReadFile(f.path(ref))
+	if err != nil {
+		return nil, errors.E(err)
+	}
+	return body, nil
+}
+
+func (f *FileBlobStore) Delete(_ context.Context, ref string) error {
+	if !fileRefPattern.MatchString(ref) {
+		return errors.Errorf("invalid blob reference %q", ref)
+	}
+	err := os.Remove(f.path(ref))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.E(err)
+	}
+	return nil
+}
+
+func (f *FileBlobStore) path(ref string) string {
+	return filepath.Join(f.Dir, ref+".blob")
+}
@@ -0,0 +1,66 @@
+package rmqx
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/C0nstantin/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestClaimCheck(t *testing.T) {
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := &ClaimCheck{Store: store, Threshold: 8}
+	ctx := context.Background()
+
+	small := &amqp.Publishing{Body: []byte("small")}
+	p, err := check.offload(ctx, small)
+	if err != nil || p != small {
+		t.Fatalf("small body must be sent as is, err %v", err)
+	}
+
+	large := &amqp.Publishing{Headers: amqp.Table{"a": "b"}, Body: []byte("large message body")}
+	p, err = check.offload(ctx, large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, ok := p.Headers[ClaimCheckHeader].(string)
+	if !ok || len(p.Body) != 0 || p.Headers["a"] != "b" {
+		t.Fatalf("large body must be offloaded, got headers %v body %q", p.Headers, p.Body)
+	}
+	if _, ok := large.Headers[ClaimCheckHeader]; ok || len(large.Body) == 0 {
+		t.Error("original publishing must not be changed")
+	}
+
+	delivery := &amqp.Delivery{Headers: p.Headers, Body: p.Body}
+	var handled []byte
+	handler := &claimCheckHandler{check: check, handler: HandlerFunc(func(d *amqp.Delivery, logger log.Logger) error {
+		handled = d.Body
+		return nil
+	})}
+	if err := handler.Handle(delivery, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(handled, large.Body) {
+		t.Errorf("handler must get the original body, got %q", handled)
+	}
+	if len(delivery.Body) != 0 {
+		t.Error("delivery must keep the reference body after the handler")
+	}
+
+	handler.acked(delivery)
+	if _, err := store.Get(ctx, ref); err == nil {
+		t.Error("body must be deleted after ack")
+	}
+}
+
+func TestFileBlobStore_invalidRef(t *testing.T) {
+	store := &FileBlobStore{Dir: t.TempDir()}
+	if _, err := store.Get(context.Background(), "../../etc/passwd"); err == nil {
+		t.Error("expected error for invalid reference")
+	}
+}
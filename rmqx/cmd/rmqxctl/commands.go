@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/C0nstantin/pkg/rmqx"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// headerFlags collects repeated -H key=value flags
+type headerFlags amqp.Table
+
+func (h headerFlags) String() string {
+	return fmt.Sprint(amqp.Table(h))
+}
+
+func (h headerFlags) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("header %q must be key=value", value)
+	}
+	h[k] = v
+	return nil
+}
+
+func declareCmd(cnf *rmqx.Config, args []string) error {
+	flags := flag.NewFlagSet("declare", flag.ExitOnError)
+	kind := flags.String("kind", "simple", "pool kind: simple, retry or repeat")
+	ttl := flags.Int("ttl", 30, "retry queue TTL in seconds, for retry kind")
+	_ = flags.Parse(args)
+
+	conn, err := cnf.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch *kind {
+	case "simple":
+		err = rmqx.DeclareSimpleTopology(conn, cnf)
+	case "retry":
+		err = rmqx.DeclareRetryTopology(conn, cnf, int32(*ttl))
+	case "repeat":
+		err = rmqx.DeclareRepeatTopology(conn, cnf)
+	default:
+		return fmt.Errorf("unknown pool kind %q", *kind)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("declared %s topology of queue %s\n", *kind, cnf.QueName)
+	return nil
+}
+
+func publishCmd(cnf *rmqx.Config, args []string) error {
+	flags := flag.NewFlagSet("publish", flag.ExitOnError)
+	file := flags.String("file", "-", "message body file, - for stdin")
+	headers := headerFlags{}
+	flags.Var(headers, "H", "header key=value, may be repeated")
+	msgType := flags.String("type", "", "message type")
+	id := flags.String("id", "", "message id")
+	contentType := flags.String("content-type", "application/json", "content type")
+	exchange := flags.String("exchange", cnf.Exchange, "exchange")
+	key := flags.String("key", cnf.RoutKey, "routing key")
+	_ = flags.Parse(args)
+
+	var body []byte
+	var err error
+	if *file == "-" {
+		body, err = io.ReadAll(os.Stdin)
+	} else {
+		body, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+
+	c := *cnf
+	c.Exchange, c.RoutKey = *exchange, *key
+	return rmqx.PublishMessage(c, &amqp.Publishing{
+		Headers:     amqp.Table(headers),
+		ContentType: *contentType,
+		MessageId:   *id,
+		Type:        *msgType,
+		Body:        body,
+	})
+}
+
+func tailCmd(cnf *rmqx.Config, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	queue := flags.String("queue", cnf.QueName, "queue to read")
+	n := flags.Int("n", 10, "number of messages, 0 - until interrupted in -bind mode")
+	bind := flags.String("bind", "", "follow new messages through a temporary queue bound to the exchange with this key")
+	_ = flags.Parse(args)
+
+	conn, ch, err := dial(cnf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if *bind != "" {
+		return follow(ch, cnf.Exchange, *bind, *n)
+	}
+	// messages are not acked, the broker returns them to the queue when the channel is closed
+	for i := 0; i < *n; i++ {
+		d, ok, err := ch.Get(*queue, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := printDelivery(&d); err != nil {
+			return err
+		}
+	}
+	return ch.Close()
+}
+
+// follow prints copies of new messages routed by the exchange, the queue is removed on exit
+func follow(ch *amqp.Channel, exchange, key string, n int) error {
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return err
+	}
+	if err := ch.QueueBind(q.Name, key, exchange, false, nil); err != nil {
+		return err
+	}
+	deliveries, err := ch.Consume(q.Name, "rmqxctl", true, true, false, false, nil)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for i := 0; n == 0 || i < n; i++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d, ok := <-deliveries:
+			if !ok {
+				return nil
+			}
+			if err := printDelivery(&d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func moveCmd(cnf *rmqx.Config, args []string) error {
+	flags := flag.NewFlagSet("move", flag.ExitOnError)
+	from := flags.String("from", cnf.AuxQueueName(rmqx.FailQueue), "source queue")
+	to := flags.String("to", "", "destination queue, published through the default exchange")
+	exchange := flags.String("exchange", "", "destination exchange, instead of -to")
+	key := flags.String("key", "", "routing key for -exchange")
+	headers := headerFlags{}
+	flags.Var(headers, "H", "move only messages with the header key=value, may be repeated")
+	body := flags.String("body", "", "move only messages with the body containing the string")
+	n := flags.Int("n", 0, "max number of moved messages, 0 - all")
+	_ = flags.Parse(args)
+
+	if *to == "" && *exchange == "" {
+		return fmt.Errorf("-to or -exchange is required")
+	}
+	if *to != "" {
+		*exchange, *key = "", *to
+	}
+
+	conn, ch, err := dial(cnf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := ch.Confirm(false); err != nil {
+		return err
+	}
+
+	// the destination may route back into the source, so only the messages in the queue
+	// before the move are checked, moved ones appended to its tail are not taken again
+	q, err := ch.QueueDeclarePassive(*from, cnf.QueueOptions.Durable, cnf.QueueOptions.AutoDelete,
+		cnf.QueueOptions.Exclusive, false, nil)
+	if err != nil {
+		return fmt.Errorf("queue %s: %w", *from, err)
+	}
+	moved := 0
+	// not matching messages stay unacked and return to the source queue when the channel is closed
+	for checked := 0; checked < q.Messages && (*n == 0 || moved < *n); checked++ {
+		d, ok, err := ch.Get(*from, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if !matches(&d, headers, *body) {
+			continue
+		}
+		confirm, err := ch.PublishWithDeferredConfirmWithContext(context.Background(), *exchange, *key, false, false, amqp.Publishing{
+			Headers:         d.Headers,
+			ContentType:     d.ContentType,
+			ContentEncoding: d.ContentEncoding,
+			DeliveryMode:    d.DeliveryMode,
+			MessageId:       d.MessageId,
+			Timestamp:       d.Timestamp,
+			Type:            d.Type,
+			AppId:           d.AppId,
+			Body:            d.Body,
+		})
+		if err != nil {
+			return err
+		}
+		if !confirm.Wait() {
+			return fmt.Errorf("message %s is nacked by the broker", d.MessageId)
+		}
+		if err := d.Ack(false); err != nil {
+			return err
+		}
+		moved++
+	}
+	fmt.Printf("moved %d messages from %s\n", moved, *from)
+	return ch.Close()
+}
+
+func matches(d *amqp.Delivery, headers headerFlags, body string) bool {
+	for k, v := range headers {
+		if fmt.Sprint(d.Headers[k]) != v {
+			return false
+		}
+	}
+	return strings.Contains(string(d.Body), body)
+}
+
+func statsCmd(cnf *rmqx.Config, args []string) error {
+	queues := args
+	if len(queues) == 0 {
+		queues = []string{cnf.QueName}
+		for _, role := range []rmqx.QueueRole{rmqx.RetryQueue, rmqx.WaitQueue, rmqx.FailQueue} {
+			queues = append(queues, cnf.AuxQueueName(role))
+		}
+	}
+
+	conn, err := cnf.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	fmt.Printf("%-40s %10s %10s\n", "QUEUE", "MESSAGES", "CONSUMERS")
+	for _, name := range queues {
+		// a failed passive declare closes the channel, so every queue gets its own
+		ch, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+		q, err := ch.QueueDeclarePassive(name, cnf.QueueOptions.Durable, cnf.QueueOptions.AutoDelete,
+			cnf.QueueOptions.Exclusive, false, nil)
+		if err != nil {
+			if len(args) == 0 {
+				continue // the pool kind has no such queue
+			}
+			return fmt.Errorf("queue %s: %w", name, err)
+		}
+		fmt.Printf("%-40s %10d %10d\n", q.Name, q.Messages, q.Consumers)
+		_ = ch.Close()
+	}
+	return nil
+}
+
+func printDelivery(d *amqp.Delivery) error {
+	return json.NewEncoder(os.Stdout).Encode(rmqx.NewFailedMessage(d))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestMatches(t *testing.T) {
+	headers := headerFlags{}
+	if err := headers.Set("tenant=a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := headers.Set("invalid"); err == nil {
+		t.Error("header without value must be rejected")
+	}
+	d := &amqp.Delivery{Headers: amqp.Table{"tenant": "a", "repeat_number": int32(2)}, Body: []byte(`{"order":42}`)}
+	if !matches(d, headers, `"order":42`) {
+		t.Error("message must match")
+	}
+	if matches(d, headers, "other") {
+		t.Error("body filter must not match")
+	}
+	if err := headers.Set("repeat_number=3"); err != nil {
+		t.Fatal(err)
+	}
+	if matches(d, headers, "") {
+		t.Error("header filter must not match")
+	}
+}
@@ -0,0 +1,29 @@
+module github.com/C0nstantin/pkg/rmqx/cmd/rmqxctl
+
+go 1.21
+
+require (
+	github.com/C0nstantin/pkg/config v0.1.0
+	github.com/C0nstantin/pkg/rmqx v0.1.0
+	github.com/rabbitmq/amqp091-go v1.10.0
+)
+
+require (
+	github.com/C0nstantin/pkg/errors v1.3.6 // indirect
+	github.com/C0nstantin/pkg/log v0.7.6 // indirect
+	github.com/C0nstantin/pkg/transport/rabbitmq/dial v0.1.0 // indirect
+	github.com/C0nstantin/pkg/utils v0.4.2 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_golang v1.20.5 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	github.com/sirupsen/logrus v1.9.3 // indirect
+	golang.org/x/sys v0.26.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,98 @@
+// Command rmqxctl declares rmqx topology and publishes, inspects and moves messages for debugging.
+//
+// The connection and names are read by config.LoadConfig into rmqx.Config, so it uses the same
+// config file (CONFIG or ./config/config.yaml) and RABBITMQ_* variables as the service.
+//
+// Usage:
+//
+//	rmqxctl [-config file] [-url amqp://...] <command> [flags]
+//
+// Commands:
+//
+//	declare  declare the queues and exchanges of a simple, retry or repeat pool
+//	publish  publish a message from a file or stdin
+//	tail     print messages of a queue without removing them
+//	move     move messages matching filters from one queue to another
+//	stats    print message and consumer counts of the pool queues
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/C0nstantin/pkg/config"
+	"github.com/C0nstantin/pkg/rmqx"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type command struct {
+	usage string
+	run   func(cnf *rmqx.Config, args []string) error
+}
+
+var commands = map[string]command{
+	"declare": {"declare [-kind simple|retry|repeat] [-ttl seconds]", declareCmd},
+	"publish": {"publish [-file path] [-H key=value]... [-type t] [-id message-id] [-exchange e] [-key k]", publishCmd},
+	"tail":    {"tail [-queue q] [-n count] [-bind pattern]", tailCmd},
+	"move":    {"move -from q [-to q | -exchange e -key k] [-H key=value]... [-body substr] [-n count]", moveCmd},
+	"stats":   {"stats [queue]...", statsCmd},
+}
+
+func main() {
+	flags := flag.NewFlagSet("rmqxctl", flag.ExitOnError)
+	configFile := flags.String("config", "", "config file, overrides CONFIG")
+	url := flags.String("url", "", "broker url, overrides RABBITMQ_URL")
+	flags.Usage = usage(flags)
+	_ = flags.Parse(os.Args[1:])
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *configFile != "" {
+		_ = os.Setenv("CONFIG", *configFile)
+	}
+	if *url != "" {
+		_ = os.Setenv("RABBITMQ_URL", *url)
+	}
+
+	cnf := &rmqx.Config{}
+	if err := config.LoadConfig(cnf); err != nil {
+		fatal(err)
+	}
+	if err := cmd.run(cnf, flags.Args()[1:]); err != nil {
+		fatal(err)
+	}
+}
+
+func usage(flags *flag.FlagSet) func() {
+	return func() {
+		out := flags.Output()
+		fmt.Fprintln(out, "Usage: rmqxctl [-config file] [-url amqp://...] <command> [flags]")
+		flags.PrintDefaults()
+		fmt.Fprintln(out, "Commands:")
+		for _, name := range []string{"declare", "publish", "tail", "move", "stats"} {
+			fmt.Fprintf(out, "  %s\n", commands[name].usage)
+		}
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "rmqxctl: %s\n", err)
+	os.Exit(1)
+}
+
+func dial(cnf *rmqx.Config) (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := cnf.Dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	return conn, ch, nil
+}
@@ -1,19 +1,41 @@
 package rmqx
 
 import (
+	"net/url"
+	"strings"
+
+	"github.com/C0nstantin/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type Config struct {
-	ConnectionUrl string `yaml:"connection_url" env:"RABBITMQ_URL" env-required:"true"`
-	Exchange      string `yaml:"exchange" env:"RABBITMQ_EXCHANGE" env-default:""`
-	RoutKey       string `yaml:"routing_key" env:"RABBITMQ_ROUTING_KEY" env-default:""`
-	QueName       string `yaml:"que_name" env:"RABBITMQ_QUEUE_NAME" env-default:""`
+	// ConnectionUrl may list several nodes of a cluster separated by commas,
+	// they are tried in NodeSelection order on connect and when the connection is lost
+	ConnectionUrl string        `yaml:"connection_url" env:"RABBITMQ_URL" env-required:"true"`
+	NodeSelection NodeSelection `yaml:"node_selection" env:"RABBITMQ_NODE_SELECTION" env-default:"round-robin"`
+	Exchange      string        `yaml:"exchange" env:"RABBITMQ_EXCHANGE" env-default:""`
+	RoutKey       string        `yaml:"routing_key" env:"RABBITMQ_ROUTING_KEY" env-default:""`
+	QueName       string        `yaml:"que_name" env:"RABBITMQ_QUEUE_NAME" env-default:""`
+	// Bindings replace the binding of the queue to Exchange with RoutKey,
+	// in env it is a ";" separated list of [exchange:]routing_key[?arg=value&...]
+	Bindings []Binding `yaml:"bindings" env:"RABBITMQ_BINDINGS" env-separator:";"`
+
+	// PasswordFile is read on every dial instead of the url password, so it can be rotated
+	PasswordFile string `yaml:"password_file" env:"RABBITMQ_PASSWORD_FILE"`
 
+	TLS             TLSOptions `yaml:"tls"`
 	ExchangeOptions ExchangeOptions
 	PublishOptions  PublishOptions
 	QueueOptions    QueueOptions
 	ConsumeOptions  ConsumeOptions
+	TopologyOptions TopologyOptions
+
+	// Topology overrides the naming strategy of TopologyOptions for retry and repeat pools
+	Topology Topology `yaml:"-"`
+	// Credentials overrides the url user and password and PasswordFile
+	Credentials CredentialsProvider `yaml:"-"`
+	// ClaimCheck offloads large message bodies to a blob store, nil disables it
+	ClaimCheck *ClaimCheck `yaml:"-"`
 }
 
 type ExchangeOptions struct {
@@ -36,6 +58,20 @@ type QueueOptions struct {
 	Exclusive  bool       `yaml:"exclusive" env:"RABBITMQ_QUEUE_EXCLUSIVE" env-default:"false"`
 	NoWait     bool       `yaml:"nowait" env:"RABBITMQ_QUEUE_NOWAIT" env-default:"false"`
 	Args       amqp.Table `yaml:"args" env:"RABBITMQ_QUEUE_ARGS"`
+	// SingleActiveConsumer declares the queue with x-single-active-consumer, see WorkerPool.EnableSingleActive
+	SingleActiveConsumer bool `yaml:"single_active_consumer" env:"RABBITMQ_QUEUE_SINGLE_ACTIVE_CONSUMER" env-default:"false"`
+}
+
+// args returns Args with the arguments of the queue options
+func (o QueueOptions) args() amqp.Table {
+	if !o.SingleActiveConsumer {
+		return o.Args
+	}
+	args := amqp.Table{"x-single-active-consumer": true}
+	for k, v := range o.Args {
+		args[k] = v
+	}
+	return args
 }
 
 type ConsumeOptions struct {
@@ -44,4 +80,85 @@ type ConsumeOptions struct {
 	NoLocal   bool       `yaml:"noLocal" env:"RABBITMQ_CONSUME_NO_LOCAL" env-default:"false"`
 	NoWait    bool       `yaml:"nowait" env:"RABBITMQ_CONSUME_NOWAIT" env-default:"false"`
 	Args      amqp.Table `yaml:"args" env:"RABBITMQ_CONSUME_ARGS"`
+	// OnCancel is what a worker does when the broker cancels its consumer,
+	// because the queue is deleted or the leader of a quorum queue moved
+	OnCancel CancelPolicy `yaml:"on_cancel" env:"RABBITMQ_CONSUME_ON_CANCEL" env-default:"reconsume"`
+}
+
+// CancelPolicy is the reaction of a worker to the consumer cancellation by the broker
+type CancelPolicy string
+
+const (
+	// CancelReconsume declares the queue again and restarts consuming, it is the default
+	CancelReconsume CancelPolicy = "reconsume"
+	// CancelFatal stops the worker with ErrConsumerCanceled
+	CancelFatal CancelPolicy = "fatal"
+)
+
+// Binding binds the queue to an exchange with a routing key pattern or, for headers exchanges,
+// with x-match and header arguments
+type Binding struct {
+	Exchange   string     `yaml:"exchange"` // empty - Config.Exchange
+	RoutingKey string     `yaml:"routing_key"`
+	Args       amqp.Table `yaml:"args"`
+}
+
+// UnmarshalText parses [exchange:]routing_key[?arg=value&...], like "events:order.*" or "headers:?x-match=all&type=order"
+func (b *Binding) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if exchange, rest, ok := strings.Cut(s, ":"); ok {
+		b.Exchange, s = exchange, rest
+	}
+	key, query, _ := strings.Cut(s, "?")
+	b.RoutingKey = key
+	if query == "" {
+		return nil
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return errors.Errorf("invalid binding arguments %q: %v", query, err)
+	}
+	b.Args = amqp.Table{}
+	for k := range values {
+		b.Args[k] = values.Get(k)
+	}
+	return nil
+}
+
+// bindings returns the bindings of the queue, the single Exchange and RoutKey binding when Bindings is empty
+func (c *Config) bindings() []Binding {
+	if len(c.Bindings) == 0 {
+		if c.Exchange == "" {
+			return nil
+		}
+		return []Binding{{Exchange: c.Exchange, RoutingKey: c.RoutKey}}
+	}
+	res := make([]Binding, len(c.Bindings))
+	for i, b := range c.Bindings {
+		if b.Exchange == "" {
+			b.Exchange = c.Exchange
+		}
+		res[i] = b
+	}
+	return res
+}
+
+// routesBack reports whether messages published to Exchange with RoutKey reach the queue,
+// retry and repeat pools return messages this way. Only direct and topic exchanges are checked.
+func (c *Config) routesBack() bool {
+	switch c.ExchangeOptions.Kind {
+	case "direct", "topic":
+	default:
+		return true
+	}
+	key := strings.Split(c.RoutKey, ".")
+	for _, b := range c.bindings() {
+		if b.Exchange != c.Exchange {
+			continue
+		}
+		if b.RoutingKey == c.RoutKey || c.ExchangeOptions.Kind == "topic" && matchTopic(strings.Split(b.RoutingKey, "."), key) {
+			return true
+		}
+	}
+	return false
 }
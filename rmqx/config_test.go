@@ -0,0 +1,38 @@
+package rmqx
+
+import "testing"
+
+func TestBinding_UnmarshalText(t *testing.T) {
+	var b Binding
+	if err := b.UnmarshalText([]byte("headers:?x-match=all&type=order")); err != nil {
+		t.Fatal(err)
+	}
+	if b.Exchange != "headers" || b.RoutingKey != "" || b.Args["x-match"] != "all" || b.Args["type"] != "order" {
+		t.Errorf("unexpected binding %+v", b)
+	}
+	b = Binding{}
+	if err := b.UnmarshalText([]byte("order.*")); err != nil {
+		t.Fatal(err)
+	}
+	if b.Exchange != "" || b.RoutingKey != "order.*" || b.Args != nil {
+		t.Errorf("unexpected binding %+v", b)
+	}
+}
+
+func TestConfig_bindings(t *testing.T) {
+	cnf := &Config{Exchange: "events", RoutKey: "order.created", ExchangeOptions: ExchangeOptions{Kind: "topic"}}
+	if b := cnf.bindings(); len(b) != 1 || b[0].RoutingKey != "order.created" || b[0].Exchange != "events" {
+		t.Errorf("unexpected default bindings %+v", b)
+	}
+	cnf.Bindings = []Binding{{RoutingKey: "user.#"}, {Exchange: "other", RoutingKey: "order.created"}}
+	if cnf.bindings()[0].Exchange != "events" {
+		t.Error("empty exchange must fall back to the config exchange")
+	}
+	if cnf.routesBack() {
+		t.Error("order.created is not routed to the queue through events")
+	}
+	cnf.Bindings = append(cnf.Bindings, Binding{RoutingKey: "order.*"})
+	if !cnf.routesBack() {
+		t.Error("order.* must route order.created back")
+	}
+}
@@ -0,0 +1,52 @@
+package rmqx
+
+import (
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/transport/rabbitmq/dial"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TLSOptions configures TLS of amqps:// connections, client certificate files enable mTLS
+type TLSOptions = dial.TLSOptions
+
+// CredentialsProvider returns the user name and password for a new connection,
+// it is called on every dial, so passwords can be rotated without restart
+type CredentialsProvider = dial.CredentialsProvider
+
+// CredentialsFunc adapts a function to the CredentialsProvider interface
+type CredentialsFunc = dial.CredentialsFunc
+
+// FileCredentials reads the password from a file, like a mounted secret, on every dial
+type FileCredentials = dial.FileCredentials
+
+// Dial connects to the broker with the TLS options and credentials of the config,
+// with several nodes in ConnectionUrl it tries them in NodeSelection order until one accepts the connection
+func (c *Config) Dial() (*amqp.Connection, error) {
+	conn, _, err := c.dial()
+	return conn, err
+}
+
+// dial is Dial which also returns the url of the connected node
+func (c *Config) dial() (*amqp.Connection, string, error) {
+	return connect(c.ConnectionUrl, c.NodeSelection, &c.TLS, c.credentials())
+}
+
+// credentials returns Credentials or FileCredentials for PasswordFile with the user of the url
+func (c *Config) credentials() CredentialsProvider {
+	if c.Credentials != nil {
+		return c.Credentials
+	}
+	if c.PasswordFile == "" {
+		return nil
+	}
+	return dial.NewFileCredentials(c.ConnectionUrl, c.PasswordFile)
+}
+
+// connect connects to the first available node of the comma separated connectionUrl and returns its url
+func connect(connectionUrl string, selection NodeSelection, tlsOptions *TLSOptions, credentials CredentialsProvider) (*amqp.Connection, string, error) {
+	conn, node, err := dial.SharedNodes(connectionUrl).Connect(selection, tlsOptions, credentials)
+	if err != nil {
+		return nil, "", errors.E(err)
+	}
+	return conn, node, nil
+}
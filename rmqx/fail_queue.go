@@ -0,0 +1,329 @@
+package rmqx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrMessageNotFound = errors.New("message not found in fail queue")
+
+// Death is an entry of the x-death header, added by the broker each time the message is dead-lettered
+type Death struct {
+	Queue       string    `json:"queue"`
+	Reason      string    `json:"reason"`
+	Exchange    string    `json:"exchange"`
+	RoutingKeys []string  `json:"routing_keys"`
+	Count       int64     `json:"count"`
+	Time        time.Time `json:"time"`
+}
+
+// FailedMessage is a message of the fail queue.
+// ID is the MessageId property, or a hash of the body for messages without one.
+type FailedMessage struct {
+	ID          string     `json:"id"`
+	MessageId   string     `json:"message_id"`
+	Type        string     `json:"type"`
+	ContentType string     `json:"content_type"`
+	Timestamp   time.Time  `json:"timestamp"`
+	RoutingKey  string     `json:"routing_key"`
+	Headers     amqp.Table `json:"headers"`
+	Deaths      []Death    `json:"deaths"`
+	Body        string     `json:"body"`
+}
+
+// MessageEdit changes a failed message before it is requeued, a nil header value removes the header
+type MessageEdit struct {
+	Body    *string    `json:"body"`
+	Headers amqp.Table `json:"headers"`
+}
+
+// FailQueueAdmin inspects and requeues messages of the fail queue of a retry or repeat pool.
+// The broker can't address a single message, so every operation reads the queue without ack
+// up to MaxScan messages and returns the untouched ones back in their order.
+type FailQueueAdmin struct {
+	cnf     *Config
+	MaxScan int
+}
+
+func NewFailQueueAdmin(cnf *Config) *FailQueueAdmin {
+	return &FailQueueAdmin{cnf: cnf, MaxScan: 10000}
+}
+
+// Name returns the fail queue name given by the config topology
+func (f *FailQueueAdmin) Name() string {
+	return f.cnf.AuxQueueName(FailQueue)
+}
+
+// Count returns the number of messages in the fail queue
+func (f *FailQueueAdmin) Count() (int, error) {
+	var count int
+	err := f.withChannel(func(ch *amqp.Channel) error {
+		q, err := ch.QueueDeclarePassive(f.Name(), f.cnf.QueueOptions.Durable, f.cnf.QueueOptions.AutoDelete,
+			f.cnf.QueueOptions.Exclusive, false, nil)
+		if err != nil {
+			return errors.Errorf("can't inspect queue %s: %v", f.Name(), err)
+		}
+		count = q.Messages
+		return nil
+	})
+	return count, err
+}
+
+// List returns up to limit messages from the head of the fail queue, leaving them in the queue
+func (f *FailQueueAdmin) List(limit int) ([]FailedMessage, error) {
+	if limit <= 0 || limit > f.MaxScan {
+		limit = f.MaxScan
+	}
+	res := []FailedMessage{}
+	err := f.scan(func(_ *amqp.Channel, d *amqp.Delivery) (bool, bool, error) {
+		res = append(res, NewFailedMessage(d))
+		return false, len(res) >= limit, nil
+	})
+	return res, err
+}
+
+// Requeue publishes the messages with ids back to the main exchange with the main routing key,
+// removing repeat_number and x-death headers so the message gets all attempts again.
+// An empty ids list requeues every message. It returns the number of requeued messages.
+func (f *FailQueueAdmin) Requeue(ctx context.Context, ids []string) (int, error) {
+	selected := idSet(ids)
+	var n int
+	err := f.scan(func(ch *amqp.Channel, d *amqp.Delivery) (bool, bool, error) {
+		if len(selected) > 0 && !selected[messageID(d)] {
+			return false, false, nil
+		}
+		if err := f.requeue(ctx, ch, d, MessageEdit{}); err != nil {
+			return false, true, err
+		}
+		n++
+		return true, len(selected) > 0 && n == len(selected), nil
+	})
+	return n, err
+}
+
+// Edit changes the message with id and requeues it like Requeue
+func (f *FailQueueAdmin) Edit(ctx context.Context, id string, edit MessageEdit) error {
+	found := false
+	err := f.scan(func(ch *amqp.Channel, d *amqp.Delivery) (bool, bool, error) {
+		if messageID(d) != id {
+			return false, false, nil
+		}
+		found = true
+		if err := f.requeue(ctx, ch, d, edit); err != nil {
+			return false, true, err
+		}
+		return true, true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("%v: %s", ErrMessageNotFound, id)
+	}
+	return nil
+}
+
+// Purge removes the messages with ids from the fail queue, an empty ids list removes every message.
+// It returns the number of removed messages.
+func (f *FailQueueAdmin) Purge(ids []string) (int, error) {
+	if len(ids) == 0 {
+		var n int
+		err := f.withChannel(func(ch *amqp.Channel) error {
+			var err error
+			n, err = ch.QueuePurge(f.Name(), false)
+			if err != nil {
+				return errors.Errorf("can't purge queue %s: %v", f.Name(), err)
+			}
+			return nil
+		})
+		return n, err
+	}
+	selected := idSet(ids)
+	var n int
+	err := f.scan(func(_ *amqp.Channel, d *amqp.Delivery) (bool, bool, error) {
+		if !selected[messageID(d)] {
+			return false, false, nil
+		}
+		n++
+		return true, n == len(selected), nil
+	})
+	return n, err
+}
+
+func (f *FailQueueAdmin) requeue(ctx context.Context, ch *amqp.Channel, d *amqp.Delivery, edit MessageEdit) error {
+	publishing := requeuePublishing(d, edit)
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, f.cnf.Exchange, f.cnf.RoutKey, false, false, publishing)
+	if err != nil {
+		return errors.Errorf("requeue to %s, with routekey %s return error %v", f.cnf.Exchange, f.cnf.RoutKey, err)
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return errors.E(err)
+	}
+	if !acked {
+		return errors.Errorf("requeue of message %s is nacked by the broker", messageID(d))
+	}
+	return nil
+}
+
+// requeuePublishing builds the publishing sending a failed message to the main queue again
+func requeuePublishing(d *amqp.Delivery, edit MessageEdit) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	delete(headers, "repeat_number")
+	delete(headers, "x-death")
+	delete(headers, "x-first-death-exchange")
+	delete(headers, "x-first-death-queue")
+	delete(headers, "x-first-death-reason")
+	for k, v := range edit.Headers {
+		if v == nil {
+			delete(headers, k)
+			continue
+		}
+		headers[k] = v
+	}
+	body := d.Body
+	if edit.Body != nil {
+		body = []byte(*edit.Body)
+	}
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		MessageId:       d.MessageId,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            body,
+	}
+}
+
+// scan calls fn for the messages of the fail queue in order. fn returns whether the message
+// must be acked and whether the scan must stop, not acked messages are returned to the queue.
+func (f *FailQueueAdmin) scan(fn func(ch *amqp.Channel, d *amqp.Delivery) (ack, stop bool, err error)) error {
+	return f.withChannel(func(ch *amqp.Channel) error {
+		if err := ch.Confirm(false); err != nil {
+			return errors.Errorf("can't enable confirms: %v", err)
+		}
+		// anything left unacked is returned to the queue when the channel is closed
+		for i := 0; i < f.MaxScan; i++ {
+			d, ok, err := ch.Get(f.Name(), false)
+			if err != nil {
+				return errors.Errorf("can't get message from %s: %v", f.Name(), err)
+			}
+			if !ok {
+				return nil
+			}
+			ack, stop, err := fn(ch, &d)
+			if ack {
+				if err := d.Ack(false); err != nil {
+					return errors.E(err)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+func (f *FailQueueAdmin) withChannel(fn func(ch *amqp.Channel) error) error {
+	conn, err := f.cnf.Dial()
+	if err != nil {
+		return err
+	}
+	defer utils.DeferCloseLog(conn)
+	ch, err := conn.Channel()
+	if err != nil {
+		return errors.Errorf("create Channel error: %v", err)
+	}
+	defer func() {
+		if !ch.IsClosed() {
+			utils.DeferCloseLog(ch)
+		}
+	}()
+	return fn(ch)
+}
+
+// NewFailedMessage converts a delivery of the fail queue
+func NewFailedMessage(d *amqp.Delivery) FailedMessage {
+	return FailedMessage{
+		ID:          messageID(d),
+		MessageId:   d.MessageId,
+		Type:        d.Type,
+		ContentType: d.ContentType,
+		Timestamp:   d.Timestamp,
+		RoutingKey:  d.RoutingKey,
+		Headers:     d.Headers,
+		Deaths:      deaths(d.Headers),
+		Body:        string(d.Body),
+	}
+}
+
+func messageID(d *amqp.Delivery) string {
+	if d.MessageId != "" {
+		return d.MessageId
+	}
+	sum := sha256.Sum256(d.Body)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Attempt returns the number of the failed attempt of the delivery consumed from queue,
+// counted by repeat pools in repeat_number and by the broker in x-death for retry pools
+func Attempt(delivery *amqp.Delivery, queue string) int {
+	if n, ok := delivery.Headers["repeat_number"].(int32); ok {
+		return int(n) + 1
+	}
+	for _, death := range deaths(delivery.Headers) {
+		if death.Queue == queue {
+			return int(death.Count) + 1
+		}
+	}
+	return 1
+}
+
+func deaths(headers amqp.Table) []Death {
+	list, _ := headers["x-death"].([]interface{})
+	res := make([]Death, 0, len(list))
+	for _, item := range list {
+		t, ok := item.(amqp.Table)
+		if !ok {
+			continue
+		}
+		death := Death{}
+		death.Queue, _ = t["queue"].(string)
+		death.Reason, _ = t["reason"].(string)
+		death.Exchange, _ = t["exchange"].(string)
+		death.Count, _ = t["count"].(int64)
+		death.Time, _ = t["time"].(time.Time)
+		keys, _ := t["routing-keys"].([]interface{})
+		for _, k := range keys {
+			if key, ok := k.(string); ok {
+				death.RoutingKeys = append(death.RoutingKeys, key)
+			}
+		}
+		res = append(res, death)
+	}
+	return res
+}
+
+func idSet(ids []string) map[string]bool {
+	res := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		res[id] = true
+	}
+	return res
+}
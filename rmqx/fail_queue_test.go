@@ -0,0 +1,60 @@
+package rmqx
+
+import (
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRequeuePublishing(t *testing.T) {
+	d := &amqp.Delivery{
+		MessageId: "42",
+		Headers: amqp.Table{
+			"repeat_number": int32(3),
+			"tenant":        "a",
+			"x-death": []interface{}{amqp.Table{
+				"queue":        "billing",
+				"reason":       "rejected",
+				"count":        int64(5),
+				"routing-keys": []interface{}{"order.created"},
+			}},
+		},
+		Body: []byte("body"),
+	}
+
+	msg := NewFailedMessage(d)
+	if msg.ID != "42" || len(msg.Deaths) != 1 || msg.Deaths[0].Count != 5 || msg.Deaths[0].RoutingKeys[0] != "order.created" {
+		t.Errorf("unexpected failed message %+v", msg)
+	}
+
+	body := "fixed"
+	p := requeuePublishing(d, MessageEdit{Body: &body, Headers: amqp.Table{"tenant": nil, "fixed": true}})
+	if _, ok := p.Headers["repeat_number"]; ok {
+		t.Error("repeat_number must be reset")
+	}
+	if _, ok := p.Headers["x-death"]; ok {
+		t.Error("x-death must be reset")
+	}
+	if _, ok := p.Headers["tenant"]; ok || p.Headers["fixed"] != true || string(p.Body) != "fixed" {
+		t.Errorf("edit is not applied: %v %q", p.Headers, p.Body)
+	}
+	if d.Headers["repeat_number"] != int32(3) {
+		t.Error("delivery headers must not be changed")
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	if n := Attempt(&amqp.Delivery{Headers: amqp.Table{"repeat_number": int32(4)}}, "billing"); n != 5 {
+		t.Errorf("expected attempt 5 from repeat_number, got %d", n)
+	}
+	retried := &amqp.Delivery{Headers: amqp.Table{"x-death": []interface{}{
+		amqp.Table{"queue": "billing.wait", "count": int64(7)},
+		amqp.Table{"queue": "billing", "count": int64(2)},
+	}}}
+	if n := Attempt(retried, "billing"); n != 3 {
+		t.Errorf("expected attempt 3 from x-death of the queue, got %d", n)
+	}
+	if n := Attempt(&amqp.Delivery{}, "billing"); n != 1 {
+		t.Errorf("expected first attempt, got %d", n)
+	}
+}
@@ -0,0 +1,27 @@
+package rmqx
+
+import (
+	"github.com/C0nstantin/pkg/transport/rabbitmq/dial"
+)
+
+// NodeSelection is the order in which the nodes of a comma separated ConnectionUrl are tried
+type NodeSelection = dial.NodeSelection
+
+const (
+	// NodeRoundRobin starts every new connection from the node after the previously chosen one
+	NodeRoundRobin = dial.NodeRoundRobin
+	// NodeShuffle tries the nodes in random order
+	NodeShuffle = dial.NodeShuffle
+)
+
+// ConnectedNode returns the url, without the password, of the node the config connected to last,
+// it is empty when that connection is closed
+func (c *Config) ConnectedNode() string {
+	return dial.SharedNodes(c.ConnectionUrl).ConnectedNode()
+}
+
+// failover reports whether the config lists several nodes, pools reconnect to another node
+// when the connection is lost only in this case
+func (c *Config) failover() bool {
+	return len(dial.SplitURLs(c.ConnectionUrl)) > 1
+}
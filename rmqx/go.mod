@@ -5,10 +5,11 @@ go 1.21
 require (
 	github.com/C0nstantin/pkg/errors v1.3.6
 	github.com/C0nstantin/pkg/log v0.7.6
+	github.com/C0nstantin/pkg/transport/rabbitmq/dial v0.1.0
 	github.com/C0nstantin/pkg/utils v0.4.2
 	github.com/prometheus/client_golang v1.20.5
 	github.com/rabbitmq/amqp091-go v1.10.0
-
+	golang.org/x/time v0.5.0
 )
 
 require (
@@ -16,7 +17,6 @@ require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
 	github.com/prometheus/client_model v0.6.1 // indirect
 	github.com/prometheus/common v0.55.0 // indirect
 	github.com/prometheus/procfs v0.15.1 // indirect
@@ -8,52 +8,147 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 )
 
 type metrics struct {
 	MsgsHandled  prometheus.Counter
 	MsgsReceived prometheus.Counter
 	MsgsRejected prometheus.Counter
+
+	CircuitState       *prometheus.GaugeVec
+	CircuitTransitions *prometheus.CounterVec
+	ConsumerCancels    *prometheus.CounterVec
+	ActiveConsumer     *prometheus.GaugeVec
+}
+
+type publisherMetrics struct {
+	MsgsSpooled  prometheus.Counter
+	MsgsReplayed prometheus.Counter
+	SpoolBytes   prometheus.Gauge
+	SpoolPending prometheus.Gauge
 }
 
-var workerMetrics *metrics
+var (
+	workerMetrics *metrics
+	metricsOnce   sync.Once
+	serveOnce     sync.Once
 
-func initMetrics() {
-	namespace := "que_system"
-	appName := "worker"
+	spoolMetrics     *publisherMetrics
+	spoolMetricsOnce sync.Once
+)
+
+// metricNames returns the namespace and the metric name prefix from the environment
+func metricNames() (namespace, appName string) {
+	namespace = "que_system"
+	appName = "worker"
 	if os.Getenv("WORKER") != "" {
 		appName = strings.ReplaceAll(os.Getenv("WORKER"), "-", "_")
 	}
 	if os.Getenv("NAMESPACE") != "" {
 		namespace = strings.ReplaceAll(os.Getenv("NAMESPACE"), "-", "_")
 	}
+	return namespace, appName
+}
 
-	workerMetrics = &metrics{
-		MsgsHandled: promauto.NewCounter(prometheus.CounterOpts{
-			Namespace: namespace,
-			Subsystem: "rmqx_worker",
-			Name:      appName + "_rmq_messages_handled_total",
-			Help:      "Number of done handled messages", // "Number of messages sent",
-		}),
-		MsgsReceived: promauto.NewCounter(prometheus.CounterOpts{
-			Namespace: namespace,
-			Subsystem: "rmqx_worker",
-			Name:      appName + "_rmq_messages_received_total",
-			Help:      "Number of messages received",
-		}),
-		MsgsRejected: promauto.NewCounter(prometheus.CounterOpts{
-			Namespace: namespace,
-			Subsystem: "rmqx_worker",
-			Name:      appName + "_rmq_messages_rejected_total",
-			Help:      "Number of messages rejected",
-		}),
-	}
+// initMetrics registers worker metrics, it is safe to call it from several pools
+func initMetrics() {
+	metricsOnce.Do(func() {
+		namespace, appName := metricNames()
+		workerMetrics = &metrics{
+			MsgsHandled: promauto.NewCounter(prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_worker",
+				Name:      appName + "_rmq_messages_handled_total",
+				Help:      "Number of done handled messages", // "Number of messages sent",
+			}),
+			MsgsReceived: promauto.NewCounter(prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_worker",
+				Name:      appName + "_rmq_messages_received_total",
+				Help:      "Number of messages received",
+			}),
+			MsgsRejected: promauto.NewCounter(prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_worker",
+				Name:      appName + "_rmq_messages_rejected_total",
+				Help:      "Number of messages rejected",
+			}),
+			CircuitState: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_worker",
+				Name:      appName + "_rmq_circuit_state",
+				Help:      "Circuit breaker state: 0 - closed, 1 - open, 2 - half-open",
+			}, []string{"queue"}),
+			CircuitTransitions: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_worker",
+				Name:      appName + "_rmq_circuit_transitions_total",
+				Help:      "Number of circuit breaker state changes",
+			}, []string{"queue", "state"}),
+			ConsumerCancels: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_worker",
+				Name:      appName + "_rmq_consumer_cancels_total",
+				Help:      "Number of consumers canceled by the broker, result: recovered, failed or fatal",
+			}, []string{"queue", "result"}),
+			ActiveConsumer: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_worker",
+				Name:      appName + "_rmq_active_consumer",
+				Help:      "1 if the pool is the single active consumer of the queue, 0 if it waits",
+			}, []string{"queue"}),
+		}
+	})
+}
 
-	http.Handle("/metrics", promhttp.Handler())
-	http.Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("pong"))
-		w.WriteHeader(http.StatusOK)
-	}))
+// initSpoolMetrics registers publisher spool metrics, it is safe to call it from several spools
+func initSpoolMetrics() {
+	spoolMetricsOnce.Do(func() {
+		namespace, appName := metricNames()
+		spoolMetrics = &publisherMetrics{
+			MsgsSpooled: promauto.NewCounter(prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_publisher",
+				Name:      appName + "_rmq_messages_spooled_total",
+				Help:      "Number of messages written to the spool while the broker was unavailable",
+			}),
+			MsgsReplayed: promauto.NewCounter(prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_publisher",
+				Name:      appName + "_rmq_messages_replayed_total",
+				Help:      "Number of spooled messages published to the broker",
+			}),
+			SpoolBytes: promauto.NewGauge(prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_publisher",
+				Name:      appName + "_rmq_spool_bytes",
+				Help:      "Size of the spool segments on disk",
+			}),
+			SpoolPending: promauto.NewGauge(prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "rmqx_publisher",
+				Name:      appName + "_rmq_spool_pending",
+				Help:      "Number of spooled messages waiting for replay",
+			}),
+		}
+	})
+}
+
+// serveMetrics starts the metrics http server once per process
+func serveMetrics() {
+	first := false
+	serveOnce.Do(func() {
+		http.Handle("/metrics", promhttp.Handler())
+		http.Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("pong"))
+			w.WriteHeader(http.StatusOK)
+		}))
+		first = true
+	})
+	if !first {
+		return
+	}
 	err := http.ListenAndServe(":8080", nil)
 	if err != nil {
 		log.Printf("ERROR failed to start prometheus service:  %s", err)
@@ -0,0 +1,131 @@
+// Package notificator sends errors of rmqx handlers to Errbit with the delivery metadata,
+// errors/notificator reports errors of HTTP requests.
+package notificator
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	errbit "github.com/C0nstantin/pkg/errors/notificator"
+	"github.com/C0nstantin/pkg/log"
+	"github.com/C0nstantin/pkg/rmqx"
+	"github.com/airbrake/gobrake/v5"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeliveryNotificator is an rmqx.ErrorHandler sending handler errors to Errbit with the delivery
+// metadata as notice context.
+//
+// The same error of the same queue is sent once per Throttle window, the next notice after the
+// window has the number of suppressed duplicates in the "suppressed" context field.
+type DeliveryNotificator struct {
+	Notifier *gobrake.Notifier
+	Queue    string
+	// Headers are copied from the delivery into the notice context
+	Headers []string
+	// Throttle is the duplicate suppression window, zero disables throttling
+	Throttle time.Duration
+
+	mu         sync.Mutex
+	sent       map[string]time.Time
+	suppressed map[string]int
+	now        func() time.Time
+}
+
+func NewDeliveryNotificator(notifier *gobrake.Notifier, queue string, headers ...string) *DeliveryNotificator {
+	return &DeliveryNotificator{
+		Notifier: notifier,
+		Queue:    queue,
+		Headers:  headers,
+		Throttle: time.Minute,
+	}
+}
+
+func (d *DeliveryNotificator) ErrorHandle(e error, delivery *amqp.Delivery) {
+	if e == nil {
+		return
+	}
+	if d.Notifier == nil {
+		log.Errorf("notifier is nil")
+		return
+	}
+	suppressed, ok := d.allow(d.key(e))
+	if !ok {
+		return
+	}
+
+	n := d.Notifier.Notice(e, nil, 0)
+	errbit.SetBacktrace(n, e)
+	n.Context["queue"] = d.Queue
+	n.Context["exchange"] = delivery.Exchange
+	n.Context["routingKey"] = delivery.RoutingKey
+	n.Context["messageId"] = delivery.MessageId
+	n.Context["attempt"] = rmqx.Attempt(delivery, d.Queue)
+	if suppressed > 0 {
+		n.Context["suppressed"] = suppressed
+	}
+	headers := map[string]interface{}{}
+	for _, h := range d.Headers {
+		if v, ok := delivery.Headers[h]; ok {
+			headers[h] = v
+		}
+	}
+	if len(headers) > 0 {
+		n.Context["headers"] = headers
+	}
+	errbit.Send(d.Notifier, n)
+}
+
+// allow reports whether the notice with key must be sent and how many duplicates were suppressed before it
+func (d *DeliveryNotificator) allow(key string) (int, bool) {
+	if d.Throttle <= 0 {
+		return 0, true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sent == nil {
+		d.sent = map[string]time.Time{}
+		d.suppressed = map[string]int{}
+	}
+	now := time.Now
+	if d.now != nil {
+		now = d.now
+	}
+	t := now()
+	if last, ok := d.sent[key]; ok && t.Sub(last) < d.Throttle {
+		d.suppressed[key]++
+		return 0, false
+	}
+	// forget old keys, so the maps don't grow with unique errors
+	for k, last := range d.sent {
+		if t.Sub(last) >= d.Throttle && d.suppressed[k] == 0 {
+			delete(d.sent, k)
+		}
+	}
+	suppressed := d.suppressed[key]
+	delete(d.suppressed, key)
+	d.sent[key] = t
+	return suppressed, true
+}
+
+// key identifies duplicates by the place the error was created and the type of its root cause,
+// messages often contain ids. A helper wrapping different errors at one place gets a key per cause type.
+func (d *DeliveryNotificator) key(e error) string {
+	var tracer errors.StackTracer
+	if errors.As(e, &tracer) && len(tracer.StackTrace()) > 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{uintptr(tracer.StackTrace()[0])}).Next()
+		return fmt.Sprintf("%s|%s:%d|%T", d.Queue, frame.File, frame.Line, rootCause(e))
+	}
+	return d.Queue + "|" + e.Error()
+}
+
+// rootCause returns the innermost error of the chain
+func rootCause(e error) error {
+	for next := errors.Unwrap(e); next != nil; next = errors.Unwrap(e) {
+		e = next
+	}
+	return e
+}
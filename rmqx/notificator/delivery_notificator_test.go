@@ -0,0 +1,49 @@
+package notificator
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+)
+
+func TestDeliveryNotificator_throttle(t *testing.T) {
+	now := time.Now()
+	d := NewDeliveryNotificator(nil, "billing")
+	d.now = func() time.Time { return now }
+
+	if _, ok := d.allow("a"); !ok {
+		t.Fatal("first notice must be sent")
+	}
+	for i := 0; i < 3; i++ {
+		if _, ok := d.allow("a"); ok {
+			t.Fatal("duplicate must be suppressed")
+		}
+	}
+	if _, ok := d.allow("b"); !ok {
+		t.Error("other error must be sent")
+	}
+	now = now.Add(time.Minute)
+	suppressed, ok := d.allow("a")
+	if !ok || suppressed != 3 {
+		t.Errorf("notice after the window must be sent with 3 suppressed, got %d %v", suppressed, ok)
+	}
+}
+
+func TestDeliveryNotificator_key(t *testing.T) {
+	d := NewDeliveryNotificator(nil, "billing")
+	var keys []string
+	for _, id := range []string{"1", "2"} {
+		keys = append(keys, d.key(errors.Errorf("order %s not found", id)))
+	}
+	if keys[0] != keys[1] {
+		t.Errorf("errors created at the same place must have the same key: %v", keys)
+	}
+
+	wrap := func(err error) error { return errors.Errorf("handle order: %v", err) }
+	if d.key(wrap(io.EOF)) == d.key(wrap(&net.AddrError{Err: "missing port"})) {
+		t.Error("errors with different root causes must have different keys")
+	}
+}
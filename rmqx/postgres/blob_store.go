@@ -0,0 +1,87 @@
+// Package postgres contains PostgreSQL backed extensions for rmqx.
+package postgres
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/jackc/pgx/v5"
+)
+
+// TxBeginner is implemented by *pgxpool.Pool and pgx_client.PgxPoolIface
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// LargeObjectStore is an rmqx.BlobStore keeping message bodies as PostgreSQL large objects,
+// the reference is the object OID.
+type LargeObjectStore struct {
+	db TxBeginner
+}
+
+func NewLargeObjectStore(db TxBeginner) *LargeObjectStore {
+	return &LargeObjectStore{db: db}
+}
+
+func (s *LargeObjectStore) Put(ctx context.Context, body []byte) (string, error) {
+	var oid uint32
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SELECT lo_from_bytea(0, $1)", body).Scan(&oid)
+	})
+	if err != nil {
+		return "", errors.Er(err, "failed to store large object")
+	}
+	return strconv.FormatUint(uint64(oid), 10), nil
+}
+
+func (s *LargeObjectStore) Get(ctx context.Context, ref string) ([]byte, error) {
+	oid, err := parseOID(ref)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SELECT lo_get($1)", oid).Scan(&body)
+	})
+	if err != nil {
+		return nil, errors.Er(err, "failed to read large object %s", ref)
+	}
+	return body, nil
+}
+
+func (s *LargeObjectStore) Delete(ctx context.Context, ref string) error {
+	oid, err := parseOID(ref)
+	if err != nil {
+		return err
+	}
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT lo_unlink($1)", oid)
+		return err
+	})
+	if err != nil {
+		return errors.Er(err, "failed to delete large object %s", ref)
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction, a failed call is rolled back and leaves no object behind
+func (s *LargeObjectStore) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func parseOID(ref string) (uint32, error) {
+	oid, err := strconv.ParseUint(ref, 10, 32)
+	if err != nil {
+		return 0, errors.Errorf("invalid large object reference %q", ref)
+	}
+	return uint32(oid), nil
+}
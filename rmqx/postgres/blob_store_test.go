@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestLargeObjectStore(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	store := NewLargeObjectStore(mock)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT lo_from_bytea\(0, \$1\)`).WithArgs([]byte("body")).
+		WillReturnRows(pgxmock.NewRows([]string{"lo_from_bytea"}).AddRow(uint32(42)))
+	mock.ExpectCommit()
+	ref, err := store.Put(ctx, []byte("body"))
+	if err != nil || ref != "42" {
+		t.Fatalf("unexpected ref %s, %v", ref, err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT lo_get\(\$1\)`).WithArgs(uint32(42)).
+		WillReturnRows(pgxmock.NewRows([]string{"lo_get"}).AddRow([]byte("body")))
+	mock.ExpectCommit()
+	body, err := store.Get(ctx, ref)
+	if err != nil || string(body) != "body" {
+		t.Fatalf("unexpected body %s, %v", body, err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT lo_unlink\(\$1\)`).WithArgs(uint32(42)).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectCommit()
+	if err := store.Delete(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLargeObjectStore_errors(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	store := NewLargeObjectStore(mock)
+	ctx := context.Background()
+	failed := errors.New("connection lost")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT lo_from_bytea`).WithArgs([]byte("body")).WillReturnError(failed)
+	mock.ExpectRollback()
+	if _, err := store.Put(ctx, []byte("body")); !errors.Is(err, failed) {
+		t.Errorf("expected put error, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT lo_get`).WithArgs(uint32(7)).WillReturnError(failed)
+	mock.ExpectRollback()
+	if _, err := store.Get(ctx, "7"); !errors.Is(err, failed) {
+		t.Errorf("expected get error, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT lo_unlink`).WithArgs(uint32(7)).WillReturnError(failed)
+	mock.ExpectRollback()
+	if err := store.Delete(ctx, "7"); !errors.Is(err, failed) {
+		t.Errorf("expected delete error, got %v", err)
+	}
+
+	mock.ExpectBegin().WillReturnError(failed)
+	if err := store.Delete(ctx, "7"); !errors.Is(err, failed) {
+		t.Errorf("expected begin error, got %v", err)
+	}
+	if _, err := store.Get(ctx, "not an oid"); err == nil {
+		t.Error("expected invalid reference error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
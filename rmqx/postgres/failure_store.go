@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	"github.com/C0nstantin/pkg/rmqx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DB is implemented by *pgxpool.Pool and pgx_client.PgxPoolIface
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+const DefaultFailuresTable = "rmqx_failures"
+
+// FailuresSchema creates the failures table, %s is the quoted table name
+const FailuresSchema = `CREATE TABLE IF NOT EXISTS %[1]s (
+	id          BIGSERIAL PRIMARY KEY,
+	queue       TEXT NOT NULL,
+	exchange    TEXT NOT NULL,
+	routing_key TEXT NOT NULL,
+	message_id  TEXT NOT NULL,
+	attempt     INT NOT NULL,
+	error       TEXT NOT NULL,
+	stack_trace TEXT NOT NULL,
+	headers     JSONB,
+	body        BYTEA,
+	failed_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (message_id);
+CREATE INDEX IF NOT EXISTS %[3]s ON %[1]s (queue, failed_at)`
+
+// Failure is a recorded handler error
+type Failure struct {
+	ID         int64
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	MessageID  string
+	Attempt    int
+	Error      string
+	StackTrace string
+	Headers    map[string]any
+	Body       []byte
+	FailedAt   time.Time
+}
+
+// FailureFilter selects failures, empty fields are not used
+type FailureFilter struct {
+	MessageID string
+	Queue     string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// FailureStore is an rmqx.ErrorHandler recording failed deliveries of Queue with the error
+// and its stack trace, so the history of a message can be found later.
+type FailureStore struct {
+	db      DB
+	queue   string
+	table   string
+	Timeout time.Duration
+}
+
+// NewFailureStore creates a store writing failures of queue to DefaultFailuresTable
+func NewFailureStore(db DB, queue string) *FailureStore {
+	return &FailureStore{db: db, queue: queue, table: DefaultFailuresTable, Timeout: 5 * time.Second}
+}
+
+// WithTable makes the store use another table
+func (s *FailureStore) WithTable(table string) *FailureStore {
+	s.table = table
+	return s
+}
+
+// CreateSchema creates the table and indexes if they don't exist
+func (s *FailureStore) CreateSchema(ctx context.Context) error {
+	query := fmt.Sprintf(FailuresSchema, s.ident(),
+		pgx.Identifier{s.table + "_message_id_idx"}.Sanitize(),
+		pgx.Identifier{s.table + "_queue_failed_at_idx"}.Sanitize())
+	if _, err := s.db.Exec(ctx, query); err != nil {
+		return errors.Er(err, "failed to create table %s", s.table)
+	}
+	return nil
+}
+
+// ErrorHandle records the failure, errors of the database are logged only
+func (s *FailureStore) ErrorHandle(e error, d *amqp.Delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	if err := s.Record(ctx, e, d); err != nil {
+		log.Errorf("failed to record failure of message %s: %s", d.MessageId, err)
+	}
+}
+
+// Record inserts the failure of the delivery
+func (s *FailureStore) Record(ctx context.Context, e error, d *amqp.Delivery) error {
+	var stack string
+	var tracer errors.StackTracer
+	if errors.As(e, &tracer) {
+		stack = strings.TrimPrefix(fmt.Sprintf("%+v", tracer.StackTrace()), "\n")
+	}
+	headers, err := json.Marshal(d.Headers)
+	if err != nil {
+		return errors.Er(err, "failed to encode headers")
+	}
+	var message string
+	if e != nil {
+		message = e.Error()
+	}
+	_, err = s.db.Exec(ctx, `INSERT INTO `+s.ident()+
+		` (queue, exchange, routing_key, message_id, attempt, error, stack_trace, headers, body)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		s.queue, d.Exchange, d.RoutingKey, d.MessageId, rmqx.Attempt(d, s.queue), message, stack, headers, d.Body)
+	if err != nil {
+		return errors.Er(err, "failed to insert failure")
+	}
+	return nil
+}
+
+// Find returns failures matching the filter, newest first
+func (s *FailureStore) Find(ctx context.Context, f FailureFilter) ([]Failure, error) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.MessageID != "" {
+		add("message_id = $%d", f.MessageID)
+	}
+	if f.Queue != "" {
+		add("queue = $%d", f.Queue)
+	}
+	if !f.From.IsZero() {
+		add("failed_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("failed_at < $%d", f.To)
+	}
+	query := `SELECT id, queue, exchange, routing_key, message_id, attempt, error, stack_trace, headers, body, failed_at FROM ` + s.ident()
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY failed_at DESC, id DESC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Er(err, "failed to query failures")
+	}
+	defer rows.Close()
+	var res []Failure
+	for rows.Next() {
+		var f Failure
+		err := rows.Scan(&f.ID, &f.Queue, &f.Exchange, &f.RoutingKey, &f.MessageID, &f.Attempt,
+			&f.Error, &f.StackTrace, &f.Headers, &f.Body, &f.FailedAt)
+		if err != nil {
+			return nil, errors.Er(err, "failed to scan failure")
+		}
+		res = append(res, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Er(err, "failed to query failures")
+	}
+	return res, nil
+}
+
+// ByMessageID returns the failure history of the message
+func (s *FailureStore) ByMessageID(ctx context.Context, messageID string) ([]Failure, error) {
+	return s.Find(ctx, FailureFilter{MessageID: messageID})
+}
+
+// ByQueue returns failures of the queue in [from, to)
+func (s *FailureStore) ByQueue(ctx context.Context, queue string, from, to time.Time) ([]Failure, error) {
+	return s.Find(ctx, FailureFilter{Queue: queue, From: from, To: to})
+}
+
+func (s *FailureStore) ident() string {
+	return pgx.Identifier{s.table}.Sanitize()
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/pashagolub/pgxmock/v3"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestFailureStore(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	store := NewFailureStore(mock, "billing")
+
+	d := &amqp.Delivery{
+		Exchange:   "orders",
+		RoutingKey: "order.created",
+		MessageId:  "42",
+		Headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"queue": "billing", "count": int64(2)},
+		}},
+		Body: []byte("body"),
+	}
+	mock.ExpectExec(`INSERT INTO "rmqx_failures"`).
+		WithArgs("billing", "orders", "order.created", "42", 3, "handler failed", pgxmock.AnyArg(), pgxmock.AnyArg(), []byte("body")).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	if err := store.Record(context.Background(), errors.New("handler failed"), d); err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(`SELECT .+ FROM "rmqx_failures" WHERE queue = \$1 AND failed_at >= \$2 ORDER BY failed_at DESC, id DESC LIMIT \$3`).
+		WithArgs("billing", from, 10).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "queue", "exchange", "routing_key", "message_id", "attempt", "error", "stack_trace", "headers", "body", "failed_at"}).
+			AddRow(int64(1), "billing", "orders", "order.created", "42", 3, "handler failed", "", map[string]any{}, []byte("body"), time.Now()))
+	failures, err := store.Find(context.Background(), FailureFilter{Queue: "billing", From: from, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Attempt != 3 {
+		t.Errorf("unexpected failures %+v", failures)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
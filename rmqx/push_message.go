@@ -3,6 +3,7 @@ package rmqx
 import (
 	"context"
 	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/transport/rabbitmq/dial"
 	"github.com/C0nstantin/pkg/utils"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"log"
@@ -11,12 +12,22 @@ import (
 // PublishMessage publishes a message to a RabbitMQ exchange.
 // It establishes a connection to the RabbitMQ server, creates a channel, declares an exchange,
 // and publishes the message to the exchange with the specified routing key.
+// Bodies larger than the claim check threshold of the config are moved to the blob store first.
 // It returns an error if any of the steps fail.
-func PublishMessage(c Config, publishing *amqp.Publishing) error {
+func PublishMessage(c Config, publishing *amqp.Publishing) (err error) {
+	publishing, err = c.ClaimCheck.offload(context.Background(), publishing)
+	if err != nil {
+		return NewFatalError(err, nil)
+	}
+	defer func() {
+		if err != nil {
+			c.ClaimCheck.discard(publishing)
+		}
+	}()
 
-	conn, err := amqp.Dial(c.ConnectionUrl)
+	conn, err := c.Dial()
 	if err != nil {
-		return NewFatalError(errors.Errorf(" connect to %s return error:  %v", c.ConnectionUrl, err), publishing.Body)
+		return NewFatalError(err, publishing.Body)
 	}
 	defer utils.DeferCloseLog(conn)
 
@@ -71,35 +82,84 @@ type Pusher interface {
 }
 
 type PusherImpl struct {
-	conn       *amqp.Connection
-	ch         *amqp.Channel
-	connectUrl string
+	conn        *amqp.Connection
+	node        string
+	ch          *amqp.Channel
+	connectUrl  string
+	selection   NodeSelection
+	tls         *TLSOptions
+	credentials CredentialsProvider
+	claimCheck  *ClaimCheck
 }
 
+// NewPusherImpl creates a pusher, connectUrl may list several comma separated nodes,
+// the pusher reconnects to the next available one when the connection is lost
 func NewPusherImpl(connectUrl string) *PusherImpl {
 	return &PusherImpl{
 		connectUrl: connectUrl,
 	}
 }
 
+// WithClaimCheck makes the pusher offload large bodies to the claim check store
+func (p *PusherImpl) WithClaimCheck(claimCheck *ClaimCheck) *PusherImpl {
+	p.claimCheck = claimCheck
+	return p
+}
+
+// WithTLS sets TLS options for amqps:// urls
+func (p *PusherImpl) WithTLS(options TLSOptions) *PusherImpl {
+	p.tls = &options
+	return p
+}
+
+// WithNodeSelection sets the order the nodes of the url are tried, NodeRoundRobin by default
+func (p *PusherImpl) WithNodeSelection(selection NodeSelection) *PusherImpl {
+	p.selection = selection
+	return p
+}
+
+// ConnectedNode returns the url, without the password, of the node the pusher is connected to
+func (p *PusherImpl) ConnectedNode() string {
+	if p.conn == nil || p.conn.IsClosed() {
+		return ""
+	}
+	return dial.RedactURL(p.node)
+}
+
+// WithCredentials makes the pusher take the user and password from the provider on connect
+func (p *PusherImpl) WithCredentials(credentials CredentialsProvider) *PusherImpl {
+	p.credentials = credentials
+	return p
+}
+
 func (p *PusherImpl) PushMessage(ctx context.Context, exchange, routingKey string, publishing *amqp.Publishing) error {
 	if err := p.connect(); err != nil {
 		return NewFatalError(err, publishing.Body)
 	}
-	err := p.ch.PublishWithContext(ctx, exchange, routingKey, false, false, *publishing)
+	publishing, err := p.claimCheck.offload(ctx, publishing)
 	if err != nil {
+		return NewFatalError(err, nil)
+	}
+	err = p.ch.PublishWithContext(ctx, exchange, routingKey, false, false, *publishing)
+	if err != nil {
+		p.claimCheck.discard(publishing)
 		return NewFatalError(errors.Errorf("PushMessage to %s, with routekey %s return error %v", exchange, routingKey, err), publishing.Body)
 	}
 	return nil
 }
 
 func (p *PusherImpl) connect() error {
-	conn, err := amqp.Dial(p.connectUrl)
-	if err != nil {
-		return errors.Er(err, " connect to %s return,", p.connectUrl)
+	if p.ch != nil && !p.ch.IsClosed() {
+		return nil
+	}
+	if p.conn == nil || p.conn.IsClosed() {
+		conn, node, err := connect(p.connectUrl, p.selection, p.tls, p.credentials)
+		if err != nil {
+			return err
+		}
+		p.conn, p.node = conn, node
 	}
-	p.conn = conn
-	ch, err := conn.Channel()
+	ch, err := p.conn.Channel()
 	if err != nil {
 		return errors.Errorf("PushMessage create Channel %v", err)
 	}
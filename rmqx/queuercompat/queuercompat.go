@@ -0,0 +1,104 @@
+// Package queuercompat runs queuer handlers and rejectors in rmqx pools, so services written
+// for queuer get rmqx pools, metrics and reconnects without rewriting their handlers.
+package queuercompat
+
+import (
+	"github.com/C0nstantin/pkg/log"
+	"github.com/C0nstantin/pkg/queuer"
+	"github.com/C0nstantin/pkg/rmqx"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Config converts the queuer config to the rmqx one, queuer defaults and environment are merged first
+func Config(c *queuer.Config) (*rmqx.Config, error) {
+	if err := c.MergeDefaults(); err != nil {
+		return nil, err
+	}
+	cnf := &rmqx.Config{
+		ConnectionUrl:   c.DSN,
+		NodeSelection:   c.NodeSelection,
+		PasswordFile:    c.PasswordFile,
+		TLS:             c.TLS,
+		Exchange:        c.Exchange,
+		RoutKey:         c.RoutKey,
+		QueName:         c.QueName,
+		ExchangeOptions: rmqx.ExchangeOptions(c.ExchangeOptions),
+		PublishOptions:  rmqx.PublishOptions(c.PublishOptions),
+		QueueOptions: rmqx.QueueOptions{
+			Durable:    c.QueueOptions.Durable,
+			AutoDelete: c.QueueOptions.AutoDelete,
+			Exclusive:  c.QueueOptions.Exclusive,
+			NoWait:     c.QueueOptions.NoWait,
+			Args:       c.QueueOptions.Args,
+		},
+		ConsumeOptions: rmqx.ConsumeOptions{
+			AutoAck:   c.ConsumeOptions.AutoAck,
+			Exclusive: c.ConsumeOptions.Exclusive,
+			NoLocal:   c.ConsumeOptions.NoLocal,
+			NoWait:    c.ConsumeOptions.NoWait,
+			Args:      c.ConsumeOptions.Args,
+			OnCancel:  rmqx.CancelReconsume,
+		},
+		Credentials: c.Credentials,
+	}
+	return cnf, nil
+}
+
+type handler struct {
+	handler queuer.WorkerHandler
+}
+
+func (h *handler) Handle(delivery *amqp.Delivery, _ log.Logger) error {
+	return h.handler.Handle(delivery)
+}
+
+// Handler wraps the queuer handler as rmqx.Handler, the rmqx logger is not passed to it
+func Handler(h queuer.WorkerHandler) rmqx.Handler {
+	return &handler{handler: h}
+}
+
+type rejector struct {
+	rejector queuer.WorkerRejector
+}
+
+func (r *rejector) Reject(delivery *amqp.Delivery) error {
+	return r.rejector.Reject(delivery)
+}
+
+// Rejector wraps the queuer rejector as rmqx.Rejector
+func Rejector(r queuer.WorkerRejector) rmqx.Rejector {
+	return &rejector{rejector: r}
+}
+
+// NewSimpleWorkerPool is the rmqx pool for StartSimpleWorker, nil rej rejects failed messages without requeue
+func NewSimpleWorkerPool(c *queuer.Config, workerCount int, h queuer.WorkerHandler, rej queuer.WorkerRejector, errorHandler rmqx.ErrorHandler) (*rmqx.WorkerPool, error) {
+	cnf, err := Config(c)
+	if err != nil {
+		return nil, err
+	}
+	var r rmqx.Rejector = &rmqx.EmptyRejector{}
+	if rej != nil {
+		r = Rejector(rej)
+	}
+	return rmqx.NewSimpleWorkerPoolWithRejector(cnf, workerCount, Handler(h), r, errorHandler)
+}
+
+// NewRetryWorkerPool is the rmqx pool for StartRetryWorker, it declares the same .topic exchange
+// and .retry and .fail queues
+func NewRetryWorkerPool(c *queuer.Config, workerCount int, h queuer.WorkerHandler, errorHandler rmqx.ErrorHandler, TTL, MaxRetry int32) (*rmqx.WorkerPool, error) {
+	cnf, err := Config(c)
+	if err != nil {
+		return nil, err
+	}
+	return rmqx.NewRetryWorkerPool(cnf, workerCount, Handler(h), errorHandler, TTL, MaxRetry)
+}
+
+// NewRepeatableWorkerPool is the rmqx pool for StartRepeatableWorker, it declares the same .topic exchange
+// and .wait and .fail queues
+func NewRepeatableWorkerPool(c *queuer.Config, workerCount int, h queuer.WorkerHandler, errorHandler rmqx.ErrorHandler, TTLBase, TTLRang, maxRepeat int32) (*rmqx.WorkerPool, error) {
+	cnf, err := Config(c)
+	if err != nil {
+		return nil, err
+	}
+	return rmqx.NewRepeatWorkerPool(cnf, workerCount, Handler(h), errorHandler, TTLBase, TTLRang, maxRepeat)
+}
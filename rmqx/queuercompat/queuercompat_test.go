@@ -0,0 +1,55 @@
+package queuercompat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/C0nstantin/pkg/queuer"
+	"github.com/C0nstantin/pkg/rmqx"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestConfig(t *testing.T) {
+	c := &queuer.Config{
+		DSN:          "amqp://a,amqp://b",
+		PasswordFile: "/run/secrets/rabbit",
+		Exchange:     "events",
+		RoutKey:      "order",
+		QueName:      "orders",
+		TLS:          queuer.TLSOptions{ServerName: "rabbit"},
+		Credentials: queuer.CredentialsFunc(func() (string, string, error) {
+			return "app", "secret", nil
+		}),
+	}
+	cnf, err := Config(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.ConnectionUrl != c.DSN || cnf.QueName != "orders" || cnf.TLS.ServerName != "rabbit" {
+		t.Errorf("unexpected config %+v", cnf)
+	}
+	if cnf.NodeSelection != rmqx.NodeRoundRobin || cnf.ExchangeOptions.Kind != "direct" || !cnf.QueueOptions.Durable {
+		t.Error("queuer defaults must be merged")
+	}
+	if user, _, _ := cnf.Credentials.Credentials(); user != "app" {
+		t.Error("credentials must be passed")
+	}
+	if cnf.AuxQueueName(rmqx.FailQueue) != "orders.fail" {
+		t.Errorf("unexpected fail queue %s", cnf.AuxQueueName(rmqx.FailQueue))
+	}
+}
+
+type failingHandler struct{}
+
+func (failingHandler) Handle(*amqp.Delivery) error {
+	return errors.New("failed")
+}
+
+func TestHandler(t *testing.T) {
+	if err := Handler(failingHandler{}).Handle(&amqp.Delivery{}, nil); err == nil {
+		t.Error("handler error must be returned")
+	}
+	if err := Handler(&queuer.EmptyWorkerHandeler{}).Handle(&amqp.Delivery{}, nil); err != nil {
+		t.Error(err)
+	}
+}
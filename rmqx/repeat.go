@@ -1,12 +1,10 @@
 package rmqx
 
 import (
-	"fmt"
 	"github.com/C0nstantin/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"log"
 	"strconv"
-	"time"
 )
 
 type RepeatableRejector struct {
@@ -18,7 +16,8 @@ type RepeatableRejector struct {
 
 func (r RepeatableRejector) Reject(delivery *amqp.Delivery) error {
 	var currentRepeat int32
-	var expiration, que string
+	var expiration string
+	var role QueueRole
 	if res, ok := delivery.Headers["repeat_number"]; ok {
 		currentRepeat = res.(int32)
 	}
@@ -26,7 +25,7 @@ func (r RepeatableRejector) Reject(delivery *amqp.Delivery) error {
 	if currentRepeat >= r.MaxRepeat {
 		expiration = ""
 		delivery.Headers["repeat_number"] = ""
-		que = ".fail"
+		role = FailQueue
 		log.Println(" message send to  fail que ")
 	} else {
 		currentRepeat++
@@ -35,30 +34,11 @@ func (r RepeatableRejector) Reject(delivery *amqp.Delivery) error {
 		}
 		delivery.Headers["repeat_number"] = currentRepeat
 		expiration = strconv.Itoa(int((r.TTLBase + r.TTLRang*(currentRepeat-1)) * 1000))
-		que = ".wait"
+		role = WaitQueue
 		log.Println(" message send to wait que with ttl  = " + expiration)
 	}
 
-	err := PublishMessage(Config{
-		ConnectionUrl:   r.Cnf.ConnectionUrl,
-		Exchange:        delivery.Exchange + ".topic",
-		RoutKey:         delivery.RoutingKey + que,
-		ExchangeOptions: r.Cnf.ExchangeOptions,
-		PublishOptions:  r.Cnf.PublishOptions,
-		QueueOptions:    r.Cnf.QueueOptions,
-		ConsumeOptions:  r.Cnf.ConsumeOptions,
-	}, &amqp.Publishing{
-		Headers:         delivery.Headers,
-		ContentType:     delivery.ContentType,
-		ContentEncoding: delivery.ContentEncoding,
-		Expiration:      expiration,
-		MessageId:       delivery.MessageId,
-		Timestamp:       time.Time{},
-		Type:            delivery.Type,
-		UserId:          delivery.UserId,
-		AppId:           delivery.AppId,
-		Body:            delivery.Body,
-	})
+	err := republish(r.Cnf, role, delivery, expiration)
 	if err != nil {
 		return err
 	}
@@ -92,68 +72,45 @@ func NewRepeatWorkerPool(cnf *Config, workerCount int, handler Handler, errHandl
 	if handler == nil {
 		return nil, errors.New("handler must be not nil")
 	}
-	conn, err := amqp.Dial(cnf.ConnectionUrl)
+	conn, node, err := cnf.dial()
 	if err != nil {
-		return nil, errors.E(err)
-	}
-	pool := &WorkerPool{
-		workers: make([]Worker, workerCount),
-		conn:    conn,
+		return nil, err
 	}
+	pool := newWorkerPool(conn, node, cnf, handler, func(conn *amqp.Connection, name string, handler Handler) (Worker, error) {
+		return NewWorker(name, cnf, conn, handler, rejector, errHandler)
+	})
 
-	err = initSimpleQue(conn, cnf)
+	err = DeclareRepeatTopology(conn, cnf)
 	if err != nil {
 		return nil, err
 	}
-	ch, err := conn.Channel()
+	err = pool.addWorkers(workerCount)
 	if err != nil {
-		return nil, errors.E(err)
-	}
-	err = ch.ExchangeDeclare(
-		cnf.Exchange+".topic",
-		cnf.ExchangeOptions.Kind,
-		cnf.ExchangeOptions.Durable,
-		cnf.ExchangeOptions.AutoDelete,
-		cnf.ExchangeOptions.Internal,
-		cnf.ExchangeOptions.NoWait,
-		cnf.ExchangeOptions.Args)
-	if err != nil {
-		return nil, errors.Errorf("NewWorker amqp declare exchanger %s error: %s", cnf.Exchange+".topic", err)
+		return nil, err
 	}
+	return pool, nil
 
-	for _, postfix := range []string{".wait", ".fail"} { // declaration retry exchange
+}
 
-		var Args amqp.Table
-		if postfix == ".wait" {
-			Args = amqp.Table{
-				"x-dead-letter-exchange":    cnf.Exchange,
-				"x-dead-letter-routing-key": cnf.RoutKey,
-			}
-		} else {
-			Args = nil
-		}
-		queName := cnf.QueName + postfix
-		_, err = ch.QueueDeclare(queName,
-			cnf.QueueOptions.Durable,
-			cnf.QueueOptions.AutoDelete,
-			cnf.QueueOptions.Exclusive,
-			cnf.QueueOptions.NoWait,
-			Args)
-		if err != nil {
-			return nil, errors.Errorf("can't declare queue %s: %s", queName, err)
-		}
-		err = ch.QueueBind(queName, cnf.RoutKey+postfix, cnf.Exchange+".topic", false, nil)
-		if err != nil {
-			return nil, errors.Errorf("Repitable worker return error when bind retry que: %v ", err)
-		}
+// DeclareRepeatTopology declares the queues and exchanges NewRepeatWorkerPool creates,
+// with Bindings one of them must match RoutKey as messages return from the wait queue through Exchange with RoutKey
+func DeclareRepeatTopology(conn *amqp.Connection, cnf *Config) error {
+	if !cnf.routesBack() {
+		return errors.Errorf("bindings of queue %s must route %s to it, messages are returned through %s", cnf.QueName, cnf.RoutKey, cnf.Exchange)
 	}
-	for i := 0; i < workerCount; i++ {
-		worker, err := NewWorker(fmt.Sprintf("worker-%d", i), cnf, conn, handler, rejector, errHandler) // Replace with your worker implementation
-		if err != nil {
-			return nil, err
-		}
-		pool.workers[i] = worker
+	err := initSimpleQue(conn, cnf)
+	if err != nil {
+		return err
 	}
-	return pool, nil
-
+	ch, err := conn.Channel()
+	if err != nil {
+		return errors.E(err)
+	}
+	defer ch.Close()
+	return declareAuxQueues(ch, cnf,
+		auxQueue{role: WaitQueue, args: amqp.Table{
+			"x-dead-letter-exchange":    cnf.Exchange,
+			"x-dead-letter-routing-key": cnf.RoutKey,
+		}},
+		auxQueue{role: FailQueue})
 }
@@ -1,10 +1,8 @@
 package rmqx
 
 import (
-	"fmt"
 	"github.com/C0nstantin/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
-	"time"
 )
 
 // RetryRejector Rejector for retry worker
@@ -22,25 +20,7 @@ func (r *RetryRejector) Reject(delivery *amqp.Delivery) error {
 	}
 
 	if currentRepeat+1 >= r.MaxRetry {
-		err := PublishMessage(Config{
-			ConnectionUrl:   r.Cnf.ConnectionUrl,
-			Exchange:        delivery.Exchange + ".topic",
-			RoutKey:         delivery.RoutingKey + ".fail",
-			ExchangeOptions: r.Cnf.ExchangeOptions,
-			PublishOptions:  r.Cnf.PublishOptions,
-			QueueOptions:    r.Cnf.QueueOptions,
-			ConsumeOptions:  r.Cnf.ConsumeOptions,
-		}, &amqp.Publishing{
-			Headers:         delivery.Headers,
-			ContentType:     delivery.ContentType,
-			ContentEncoding: delivery.ContentEncoding,
-			MessageId:       delivery.MessageId,
-			Timestamp:       time.Time{},
-			Type:            delivery.Type,
-			UserId:          delivery.UserId,
-			AppId:           delivery.AppId,
-			Body:            delivery.Body,
-		})
+		err := republish(r.Cnf, FailQueue, delivery, "")
 		if err != nil {
 			return err
 		}
@@ -69,82 +49,67 @@ func NewRetryWorkerPool(cnf *Config, workerCount int, handler Handler, errHandle
 	if handler == nil {
 		return nil, errors.New("handler must be not nil")
 	}
-	conn, err := amqp.Dial(cnf.ConnectionUrl)
+	conn, node, err := cnf.dial()
 	if err != nil {
-		return nil, errors.E(err)
-	}
-	pool := &WorkerPool{
-		workers: make([]Worker, workerCount),
-		conn:    conn,
+		return nil, err
 	}
+	pool := newWorkerPool(conn, node, cnf, handler, func(conn *amqp.Connection, name string, handler Handler) (Worker, error) {
+		return NewWorker(name, cnf, conn, handler, rejector, errHandler)
+	})
 
 	if len(cnf.Exchange) == 0 || len(cnf.QueName) == 0 || len(cnf.RoutKey) == 0 {
 		return nil, errors.New("Invalid config for repeating")
 	}
 
+	err = DeclareRetryTopology(conn, cnf, TTL)
+	if err != nil {
+		return nil, err
+	}
+	err = pool.addWorkers(workerCount)
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// DeclareRetryTopology declares the queues and exchanges NewRetryWorkerPool creates, TTL is in seconds.
+// Messages return from the retry queue through Exchange with RoutKey, so with Bindings one of them must match RoutKey.
+// It sets the dead letter arguments of cnf.QueueOptions.
+func DeclareRetryTopology(conn *amqp.Connection, cnf *Config, TTL int32) error {
+	if !cnf.routesBack() {
+		return errors.Errorf("bindings of queue %s must route %s to it, messages are returned through %s", cnf.QueName, cnf.RoutKey, cnf.Exchange)
+	}
+	topology := cnf.topology()
+	retryExchange, _ := topology.RetryExchange(cnf)
+	_, retryKey := topology.Queue(cnf, RetryQueue)
 	Args := amqp.Table{
-		"x-dead-letter-exchange":    cnf.Exchange + ".topic",
-		"x-dead-letter-routing-key": cnf.RoutKey + ".retry",
+		"x-dead-letter-exchange":    retryExchange,
+		"x-dead-letter-routing-key": retryKey,
 	}
 
 	cnf.QueueOptions.Args = Args
 
-	err = initSimpleQue(conn, cnf)
+	err := initSimpleQue(conn, cnf)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	ch, err := conn.Channel()
 	if err != nil {
-		return nil, errors.E(err)
+		return errors.E(err)
 	}
-	err = ch.ExchangeDeclare(
-		cnf.Exchange+".topic",
-		cnf.ExchangeOptions.Kind,
-		cnf.ExchangeOptions.Durable,
-		cnf.ExchangeOptions.AutoDelete,
-		cnf.ExchangeOptions.Internal,
-		cnf.ExchangeOptions.NoWait,
-		cnf.ExchangeOptions.Args)
+	err = declareAuxQueues(ch, cnf,
+		auxQueue{role: RetryQueue, args: amqp.Table{
+			"x-dead-letter-exchange":    cnf.Exchange,
+			"x-dead-letter-routing-key": cnf.RoutKey,
+			"x-message-ttl":             TTL * 1000, // second
+		}},
+		auxQueue{role: FailQueue})
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("NewWorker amqp declare exchanger %s error: %s", cnf.Exchange+".topic", err))
-	}
-
-	for _, postfix := range []string{".retry", ".fail"} {
-		var Args amqp.Table
-		if postfix == ".retry" {
-			Args = amqp.Table{
-				"x-dead-letter-exchange":    cnf.Exchange,
-				"x-dead-letter-routing-key": cnf.RoutKey,
-				"x-message-ttl":             TTL * 1000, // second
-			}
-		} else {
-			Args = nil
-		}
-
-		_, err = ch.QueueDeclare(cnf.QueName+postfix,
-			cnf.QueueOptions.Durable,
-			cnf.QueueOptions.AutoDelete,
-			cnf.QueueOptions.Exclusive,
-			cnf.QueueOptions.NoWait,
-			Args)
-		if err != nil {
-			return nil, errors.New(fmt.Sprintf("Error after declarate que retry: %v", err))
-		}
-		err = ch.QueueBind(cnf.QueName+postfix, cnf.RoutKey+postfix, cnf.Exchange+".topic", false, nil)
-		if err != nil {
-			return nil, errors.New(fmt.Sprintf("Repitable worker return error when bind retry que: %v ", err))
-		}
+		return err
 	}
 	err = ch.Close()
 	if err != nil {
-		return nil, errors.E(err)
-	}
-	for i := 0; i < workerCount; i++ {
-		worker, err := NewWorker(fmt.Sprintf("worker-%d", i), cnf, conn, handler, rejector, errHandler) // Replace with your worker implementation
-		if err != nil {
-			return nil, err
-		}
-		pool.workers[i] = worker
+		return errors.E(err)
 	}
-	return pool, nil
+	return nil
 }
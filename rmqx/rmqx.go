@@ -10,6 +10,7 @@ import (
 var (
 	ErrConnectionClosed = errors.New("Connection closed. ")
 	ErrChanelClosed     = errors.New("Chanel closed. ")
+	ErrConsumerCanceled = errors.New("Consumer canceled. ")
 )
 
 // Pool interface represents a pool of workers
@@ -0,0 +1,140 @@
+package rmqx
+
+import (
+	"strings"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HandlerFunc adapts a function to the Handler interface
+type HandlerFunc func(delivery *amqp.Delivery, logger log.Logger) error
+
+func (f HandlerFunc) Handle(delivery *amqp.Delivery, logger log.Logger) error {
+	return f(delivery, logger)
+}
+
+// UnmatchedPolicy defines what Router does with a message no route and no fallback handler matches
+type UnmatchedPolicy int
+
+const (
+	// UnmatchedReject rejects the message without requeue, the pool rejector is not called
+	UnmatchedReject UnmatchedPolicy = iota
+	// UnmatchedAck acknowledges and drops the message
+	UnmatchedAck
+	// UnmatchedFail publishes the message to the fail queue of a retry or repeat pool
+	UnmatchedFail
+)
+
+var ErrNoRoute = errors.New("no route for message")
+
+type route struct {
+	pattern []string
+	handler Handler
+}
+
+// Router is a Handler dispatching messages to other handlers by the Type property
+// or by topic-style routing key patterns, where "*" matches exactly one word and "#" matches zero or more words.
+//
+// Routes by type are checked first, then routing key patterns in order of registration,
+// then the fallback handler. If nothing matches the unmatched policy is applied.
+type Router struct {
+	types     map[string]Handler
+	keys      []route
+	fallback  Handler
+	unmatched UnmatchedPolicy
+	cnf       *Config
+}
+
+// NewRouter creates a router, cnf is used only by the UnmatchedFail policy to find the fail queue
+func NewRouter(cnf *Config) *Router {
+	return &Router{
+		types: map[string]Handler{},
+		cnf:   cnf,
+	}
+}
+
+// HandleType registers handler for messages with the Type property equal to msgType
+func (r *Router) HandleType(msgType string, handler Handler) *Router {
+	r.types[msgType] = handler
+	return r
+}
+
+// HandleRoutingKey registers handler for messages with routing key matching the topic pattern, like "order.*" or "user.#"
+func (r *Router) HandleRoutingKey(pattern string, handler Handler) *Router {
+	r.keys = append(r.keys, route{pattern: strings.Split(pattern, "."), handler: handler})
+	return r
+}
+
+// Fallback registers handler for messages not matching any route
+func (r *Router) Fallback(handler Handler) *Router {
+	r.fallback = handler
+	return r
+}
+
+// OnUnmatched sets the policy for messages not matching any route when there is no fallback handler
+func (r *Router) OnUnmatched(policy UnmatchedPolicy) *Router {
+	r.unmatched = policy
+	return r
+}
+
+func (r *Router) Handle(delivery *amqp.Delivery, logger log.Logger) error {
+	if handler := r.match(delivery); handler != nil {
+		return handler.Handle(delivery, logger)
+	}
+	if r.fallback != nil {
+		return r.fallback.Handle(delivery, logger)
+	}
+
+	err := errors.Errorf("%v: type %q, routing key %q", ErrNoRoute, delivery.Type, delivery.RoutingKey)
+	switch r.unmatched {
+	case UnmatchedAck:
+		logger.Warnf("%s, message %s dropped", err, delivery.MessageId)
+		return nil
+	case UnmatchedFail:
+		return r.fail(delivery)
+	default:
+		return NewRejectError(err)
+	}
+}
+
+func (r *Router) match(delivery *amqp.Delivery) Handler {
+	if handler, ok := r.types[delivery.Type]; ok && delivery.Type != "" {
+		return handler
+	}
+	key := strings.Split(delivery.RoutingKey, ".")
+	for _, rt := range r.keys {
+		if matchTopic(rt.pattern, key) {
+			return rt.handler
+		}
+	}
+	return nil
+}
+
+func (r *Router) fail(delivery *amqp.Delivery) error {
+	if r.cnf == nil {
+		return NewRejectError(errors.New("router has no config for the fail queue"))
+	}
+	return republish(r.cnf, FailQueue, delivery, "")
+}
+
+// matchTopic reports whether the routing key words match the topic pattern words
+func matchTopic(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchTopic(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchTopic(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && matchTopic(pattern[1:], key[1:])
+	}
+}
@@ -0,0 +1,96 @@
+package rmqx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.created", "order.updated", false},
+		{"order.*", "order.created", true},
+		{"order.*", "order", false},
+		{"order.*", "order.created.v2", false},
+		{"*.created", "user.created", true},
+		{"user.#", "user", true},
+		{"user.#", "user.created.v2", true},
+		{"user.#", "order.created", false},
+		{"#", "any.thing", true},
+		{"#.v2", "order.created.v2", true},
+		{"order.#.v2", "order.v2", true},
+		{"order.#.v2", "order.created.v3", false},
+	}
+	for _, tt := range tests {
+		got := matchTopic(strings.Split(tt.pattern, "."), strings.Split(tt.key, "."))
+		if got != tt.want {
+			t.Errorf("pattern %q key %q: expected %v, got %v", tt.pattern, tt.key, tt.want, got)
+		}
+	}
+}
+
+func TestRouter_Handle(t *testing.T) {
+	var called string
+	handler := func(name string) Handler {
+		return HandlerFunc(func(delivery *amqp.Delivery, logger log.Logger) error {
+			called = name
+			return nil
+		})
+	}
+	router := NewRouter(nil).
+		HandleType("invoice", handler("invoice")).
+		HandleRoutingKey("order.*", handler("order")).
+		HandleRoutingKey("#", handler("any"))
+	logger := log.NewNopLogger()
+
+	tests := []struct {
+		delivery amqp.Delivery
+		want     string
+	}{
+		{amqp.Delivery{Type: "invoice", RoutingKey: "order.created"}, "invoice"},
+		{amqp.Delivery{RoutingKey: "order.created"}, "order"},
+		{amqp.Delivery{RoutingKey: "user.created"}, "any"},
+	}
+	for _, tt := range tests {
+		called = ""
+		if err := router.Handle(&tt.delivery, logger); err != nil {
+			t.Fatal(err)
+		}
+		if called != tt.want {
+			t.Errorf("expected handler %q, got %q", tt.want, called)
+		}
+	}
+}
+
+func TestRouter_Unmatched(t *testing.T) {
+	logger := log.NewNopLogger()
+	delivery := &amqp.Delivery{Type: "unknown", RoutingKey: "user.created"}
+	router := NewRouter(nil).HandleRoutingKey("order.#", &EmptyHandler{})
+
+	err := router.Handle(delivery, logger)
+	var r *RejectError
+	if !errors.As(err, &r) || !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected reject error, got %v", err)
+	}
+
+	if err := router.OnUnmatched(UnmatchedAck).Handle(delivery, logger); err != nil {
+		t.Errorf("expected message to be acked, got %v", err)
+	}
+
+	called := false
+	router.Fallback(HandlerFunc(func(delivery *amqp.Delivery, logger log.Logger) error {
+		called = true
+		return nil
+	}))
+	if err := router.Handle(delivery, logger); err != nil || !called {
+		t.Errorf("expected fallback handler to be called, err %v", err)
+	}
+}
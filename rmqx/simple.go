@@ -1,12 +1,17 @@
 package rmqx
 
 import (
-	"fmt"
 	"github.com/C0nstantin/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 func NewSimpleWorkerPool(config *Config, workerCount int, handler Handler, errorHandler ErrorHandler) (*WorkerPool, error) {
+	return NewSimpleWorkerPoolWithRejector(config, workerCount, handler, &EmptyRejector{}, errorHandler)
+}
+
+// NewSimpleWorkerPoolWithRejector is NewSimpleWorkerPool which passes failed messages to rejector
+// instead of rejecting them without requeue
+func NewSimpleWorkerPoolWithRejector(config *Config, workerCount int, handler Handler, rejector Rejector, errorHandler ErrorHandler) (*WorkerPool, error) {
 	if workerCount <= 0 {
 		return nil, errors.New("worker count must be greater than 0")
 	}
@@ -16,26 +21,30 @@ func NewSimpleWorkerPool(config *Config, workerCount int, handler Handler, error
 	if handler == nil {
 		return nil, errors.New("handler must be not nil")
 	}
-	conn, err := amqp.Dial(config.ConnectionUrl)
-	if err != nil {
-		return nil, errors.E(err)
+	if rejector == nil {
+		return nil, errors.New("rejector must be not nil")
 	}
-	pool := &WorkerPool{
-		workers: make([]Worker, workerCount),
-		conn:    conn,
+	conn, node, err := config.dial()
+	if err != nil {
+		return nil, err
 	}
+	pool := newWorkerPool(conn, node, config, handler, func(conn *amqp.Connection, name string, handler Handler) (Worker, error) {
+		return NewWorker(name, config, conn, handler, rejector, errorHandler)
+	})
 
-	err = initSimpleQue(conn, config)
+	err = DeclareSimpleTopology(conn, config)
 	if err != nil {
 		return nil, err
 	}
 
-	for i := 0; i < workerCount; i++ {
-		worker, err := NewWorker(fmt.Sprintf("worker-%d", i), config, conn, handler, &EmptyRejector{}, errorHandler) // Replace with your worker implementation
-		if err != nil {
-			return nil, err
-		}
-		pool.workers[i] = worker
+	err = pool.addWorkers(workerCount)
+	if err != nil {
+		return nil, err
 	}
 	return pool, nil
 }
+
+// DeclareSimpleTopology declares the queue, exchange and binding NewSimpleWorkerPool creates
+func DeclareSimpleTopology(conn *amqp.Connection, config *Config) error {
+	return initSimpleQue(conn, config)
+}
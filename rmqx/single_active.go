@@ -0,0 +1,160 @@
+package rmqx
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// SingleActiveOptions configures single active consumer mode of a WorkerPool.
+//
+// The broker does not tell a consumer of a x-single-active-consumer queue that it became active,
+// so the pools of several replicas elect the active one with an exclusive consumer of LockQueue.
+// Only the pool holding the lock runs its workers, the others retry every RetryInterval.
+// The x-single-active-consumer argument of the main queue keeps deliveries on one consumer
+// while the lock moves to another replica.
+type SingleActiveOptions struct {
+	LockQueue     string        `yaml:"lock_queue" env:"RABBITMQ_SINGLE_ACTIVE_LOCK_QUEUE"` // empty - queue name with .active suffix
+	RetryInterval time.Duration `yaml:"retry_interval" env:"RABBITMQ_SINGLE_ACTIVE_RETRY_INTERVAL" env-default:"5s"`
+
+	// OnActive is called when the pool becomes the active consumer
+	OnActive func() `yaml:"-"`
+	// OnInactive is called when the pool loses the activity, its workers are already stopped
+	OnInactive func() `yaml:"-"`
+}
+
+type singleActive struct {
+	opts   SingleActiveOptions
+	active atomic.Bool
+	// acquire takes the lock and returns the channel notified when the lock is lost
+	acquire func(conn *amqp.Connection, queue string) (<-chan *amqp.Error, error)
+}
+
+// EnableSingleActive switches the pool to single active consumer mode, the queue must be declared
+// with QueueOptions.SingleActiveConsumer. It must be called before Start.
+func (p *WorkerPool) EnableSingleActive(opts SingleActiveOptions) error {
+	if !p.config.QueueOptions.SingleActiveConsumer {
+		return errors.Errorf("queue %s must be declared with single active consumer", p.config.QueName)
+	}
+	if opts.LockQueue == "" {
+		opts.LockQueue = p.config.QueName + ".active"
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 5 * time.Second
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.single = &singleActive{opts: opts, acquire: acquireLock}
+	return nil
+}
+
+// IsActive reports whether the pool consumes messages, it is always true without single active consumer mode
+func (p *WorkerPool) IsActive() bool {
+	return p.single == nil || p.single.active.Load()
+}
+
+// lead acquires the lock, runs the workers while the lock is held and retries when it is lost
+func (p *WorkerPool) lead(ctx context.Context, errChan chan<- error) {
+	opts := p.single.opts
+	for {
+		p.mu.Lock()
+		conn := p.conn
+		p.mu.Unlock()
+		lost, err := p.single.acquire(conn, opts.LockQueue)
+		if err == nil {
+			p.activate(ctx, errChan)
+			select {
+			case <-ctx.Done():
+				if err := p.deactivate(); err != nil {
+					log.Errorf("%s", err)
+				}
+				return
+			case err := <-lost:
+				log.Warnf("queue %s: single active consumer lock lost: %v", p.config.QueName, err)
+				if err := p.deactivate(); err != nil {
+					// the pool has no workers to run on the next activation, Start returns the error
+					select {
+					case errChan <- err:
+					default:
+					}
+					return
+				}
+			}
+		} else {
+			log.Infof("queue %s is consumed by another instance: %s", p.config.QueName, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(opts.RetryInterval):
+		}
+	}
+}
+
+// acquireLock consumes the lock queue exclusively, the broker refuses the consumer while another one holds it,
+// the lock is lost with the channel of the consumer
+func acquireLock(conn *amqp.Connection, queue string) (<-chan *amqp.Error, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, errors.E(err)
+	}
+	// the queue is removed with its last consumer, so a lock of a crashed instance does not outlive its connection
+	_, err = ch.QueueDeclare(queue, false, true, false, false, nil)
+	if err == nil {
+		_, err = ch.Consume(queue, "", false, true, false, false, nil)
+	}
+	if err != nil {
+		if !ch.IsClosed() {
+			_ = ch.Close()
+		}
+		return nil, errors.E(err)
+	}
+	return ch.NotifyClose(make(chan *amqp.Error, 1)), nil
+}
+
+func (p *WorkerPool) activate(ctx context.Context, errChan chan<- error) {
+	p.mu.Lock()
+	for i, worker := range p.workers {
+		p.cancels[i] = p.runWorker(ctx, worker, errChan)
+	}
+	p.single.active.Store(true)
+	p.mu.Unlock()
+	workerMetrics.ActiveConsumer.WithLabelValues(p.config.QueName).Set(1)
+	log.Infof("✅ queue %s: this instance is the active consumer", p.config.QueName)
+	if p.single.opts.OnActive != nil {
+		p.single.opts.OnActive()
+	}
+}
+
+// deactivate stops the workers, they are replaced by new ones which run on the next activation
+func (p *WorkerPool) deactivate() error {
+	p.mu.Lock()
+	p.single.active.Store(false)
+	for i, cancel := range p.cancels {
+		if cancel != nil {
+			cancel()
+			p.cancels[i] = nil
+		}
+	}
+	var err error
+	for i := range p.workers {
+		var worker Worker
+		if worker, err = p.spawn(); err != nil {
+			break
+		}
+		p.workers[i] = worker
+	}
+	p.mu.Unlock()
+	workerMetrics.ActiveConsumer.WithLabelValues(p.config.QueName).Set(0)
+	if p.single.opts.OnInactive != nil {
+		p.single.opts.OnInactive()
+	}
+	if err != nil {
+		return errors.Er(err, "queue %s: failed to replace the stopped workers", p.config.QueName)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package rmqx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestQueueOptions_args(t *testing.T) {
+	opts := QueueOptions{Args: amqp.Table{"x-queue-type": "quorum"}}
+	if _, ok := opts.args()["x-single-active-consumer"]; ok {
+		t.Error("single active consumer must be disabled by default")
+	}
+	opts.SingleActiveConsumer = true
+	args := opts.args()
+	if args["x-single-active-consumer"] != true || args["x-queue-type"] != "quorum" {
+		t.Errorf("unexpected args %v", args)
+	}
+	if len(opts.Args) != 1 {
+		t.Error("configured args must not be changed")
+	}
+}
+
+func TestWorkerPool_EnableSingleActive(t *testing.T) {
+	cnf := &Config{QueName: "jobs"}
+	pool := newWorkerPool(nil, "", cnf, &EmptyHandler{}, nil)
+	if !pool.IsActive() {
+		t.Error("pool without single active consumer mode must be active")
+	}
+	if err := pool.EnableSingleActive(SingleActiveOptions{}); err == nil {
+		t.Error("expected error for queue without single active consumer")
+	}
+	cnf.QueueOptions.SingleActiveConsumer = true
+	if err := pool.EnableSingleActive(SingleActiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if pool.IsActive() {
+		t.Error("pool must be inactive until the lock is acquired")
+	}
+	if pool.single.opts.LockQueue != "jobs.active" || pool.single.opts.RetryInterval != 5*time.Second {
+		t.Errorf("unexpected defaults %+v", pool.single.opts)
+	}
+}
+
+// fakeWorker runs until its context is done
+type fakeWorker struct {
+	running chan struct{}
+	stopped chan struct{}
+}
+
+func newFakeWorker() *fakeWorker {
+	return &fakeWorker{running: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+func (w *fakeWorker) Run(ctx context.Context) error {
+	close(w.running)
+	<-ctx.Done()
+	close(w.stopped)
+	return nil
+}
+
+func (w *fakeWorker) Close() error { return nil }
+
+func wait(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for %s", what)
+	}
+}
+
+func TestWorkerPool_lead(t *testing.T) {
+	initMetrics()
+	var (
+		mu      sync.Mutex
+		workers []*fakeWorker
+		fail    error
+	)
+	factory := func(_ *amqp.Connection, _ string, _ Handler) (Worker, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail != nil {
+			return nil, fail
+		}
+		w := newFakeWorker()
+		workers = append(workers, w)
+		return w, nil
+	}
+	cnf := &Config{QueName: "jobs", QueueOptions: QueueOptions{SingleActiveConsumer: true}}
+	pool := newWorkerPool(nil, "", cnf, &EmptyHandler{}, factory)
+	if err := pool.addWorkers(2); err != nil {
+		t.Fatal(err)
+	}
+	active, inactive := make(chan struct{}, 1), make(chan struct{}, 1)
+	err := pool.EnableSingleActive(SingleActiveOptions{
+		RetryInterval: time.Millisecond,
+		OnActive:      func() { active <- struct{}{} },
+		OnInactive:    func() { inactive <- struct{}{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another instance holds the lock first, then it is acquired and lost twice
+	locks := make(chan chan *amqp.Error, 2)
+	var attempts int
+	pool.single.acquire = func(_ *amqp.Connection, _ string) (<-chan *amqp.Error, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("locked by another instance")
+		}
+		lost := make(chan *amqp.Error, 1)
+		locks <- lost
+		return lost, nil
+	}
+	pool.wg = &sync.WaitGroup{}
+	pool.cancels = make([]context.CancelFunc, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errChan := make(chan error, 2)
+	go pool.lead(ctx, errChan)
+
+	wait(t, active, "activation")
+	if !pool.IsActive() {
+		t.Error("pool holding the lock must be active")
+	}
+	mu.Lock()
+	first := workers[:2]
+	mu.Unlock()
+	for _, w := range first {
+		wait(t, w.running, "worker start")
+	}
+
+	lost := <-locks
+	lost <- &amqp.Error{Reason: "channel closed"}
+	wait(t, inactive, "deactivation")
+	for _, w := range first {
+		wait(t, w.stopped, "worker stop")
+	}
+	pool.mu.Lock()
+	replaced := pool.workers[0] != first[0] && pool.workers[1] != first[1]
+	pool.mu.Unlock()
+	if !replaced {
+		t.Error("stopped workers must be replaced")
+	}
+
+	wait(t, active, "second activation")
+	mu.Lock()
+	second := workers[2:4]
+	fail = errors.New("no channel")
+	mu.Unlock()
+	for _, w := range second {
+		wait(t, w.running, "replaced worker start")
+	}
+	lost = <-locks
+	lost <- &amqp.Error{Reason: "channel closed"}
+	select {
+	case err := <-errChan:
+		if err == nil {
+			t.Error("failed replacement must be reported")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failed replacement must stop the pool")
+	}
+	if pool.IsActive() {
+		t.Error("pool without the lock must be inactive")
+	}
+}
@@ -0,0 +1,524 @@
+package rmqx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	"github.com/C0nstantin/pkg/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrSpoolFull is returned when a message can't be spooled because the spool reached its max size
+var ErrSpoolFull = errors.New("spool is full")
+
+// FsyncPolicy defines when spool segments are flushed to disk
+type FsyncPolicy string
+
+const (
+	// FsyncAlways syncs the segment after every spooled message
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval syncs the segment every FsyncInterval in Run
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever leaves flushing to the operating system
+	FsyncNever FsyncPolicy = "never"
+)
+
+type SpoolOptions struct {
+	Dir            string        `yaml:"dir" env:"RABBITMQ_SPOOL_DIR" env-default:"./spool"`
+	MaxSize        int64         `yaml:"max_size" env:"RABBITMQ_SPOOL_MAX_SIZE" env-default:"1073741824"`
+	SegmentSize    int64         `yaml:"segment_size" env:"RABBITMQ_SPOOL_SEGMENT_SIZE" env-default:"67108864"`
+	Fsync          FsyncPolicy   `yaml:"fsync" env:"RABBITMQ_SPOOL_FSYNC" env-default:"always"`
+	FsyncInterval  time.Duration `yaml:"fsync_interval" env:"RABBITMQ_SPOOL_FSYNC_INTERVAL" env-default:"1s"`
+	ReplayInterval time.Duration `yaml:"replay_interval" env:"RABBITMQ_SPOOL_REPLAY_INTERVAL" env-default:"5s"`
+}
+
+func (o *SpoolOptions) validate() error {
+	if o.Dir == "" {
+		return errors.New("spool: dir is required")
+	}
+	if o.MaxSize <= 0 || o.SegmentSize <= 0 {
+		return errors.Errorf("spool: max size %d and segment size %d must be positive", o.MaxSize, o.SegmentSize)
+	}
+	switch o.Fsync {
+	case FsyncAlways, FsyncNever:
+	case FsyncInterval:
+		if o.FsyncInterval <= 0 {
+			return errors.New("spool: fsync interval must be positive")
+		}
+	default:
+		return errors.Errorf("spool: unknown fsync policy %q", o.Fsync)
+	}
+	if o.ReplayInterval <= 0 {
+		return errors.New("spool: replay interval must be positive")
+	}
+	return nil
+}
+
+func init() {
+	// header values are sent as interfaces, basic types are registered by gob itself
+	gob.Register(amqp.Table{})
+	gob.Register([]interface{}{})
+	gob.Register(time.Time{})
+	gob.Register(amqp.Decimal{})
+}
+
+// spoolRecord is a publish waiting for the broker, the connection is not written to disk,
+// so passwords of urls do not leak to the spool
+type spoolRecord struct {
+	Exchange        string
+	RoutKey         string
+	ExchangeOptions ExchangeOptions
+	Publishing      amqp.Publishing
+}
+
+type spoolSegment struct {
+	path     string
+	size     int64
+	records  int
+	replayed int
+}
+
+// frame header is the payload length and its crc32
+const spoolHeaderSize = 8
+
+// Spool publishes messages like PublishMessage, but when the broker is unreachable
+// it appends them to segment files in Dir and Run replays them in order once the broker is back.
+// While the spool is not empty new messages are appended to it too, so the order is kept.
+//
+// Replay is at-least-once: a segment is removed only after all its messages are confirmed by
+// the broker, so a crash during replay publishes the rest of the segment again after restart.
+//
+// A spool belongs to one broker: messages are replayed via the config of NewSpool whatever config they were published with.
+type Spool struct {
+	opts SpoolOptions
+	// conn is the broker of replay, its ConnectionUrl, NodeSelection, TLS, PasswordFile
+	// and Credentials are used, the spool keeps only exchanges and messages
+	conn Config
+
+	// publishMu keeps the order of Publish, a message must not pass the spool while it is being written
+	publishMu sync.Mutex
+
+	mu       sync.Mutex
+	segments []*spoolSegment
+	writer   *os.File
+	seq      int64
+	size     int64
+	pending  int
+
+	replayMu  sync.Mutex
+	publisher spoolPublisher
+}
+
+// NewSpool opens the spool directory, messages left by a previous run are replayed by Run to the broker of conn
+func NewSpool(conn Config, opts SpoolOptions) (*Spool, error) {
+	if conn.ConnectionUrl == "" {
+		return nil, errors.New("spool: connection url is required")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, errors.E(err)
+	}
+	s := &Spool{opts: opts, conn: conn}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	initSpoolMetrics()
+	s.updateGauges()
+	return s, nil
+}
+
+// load finds segments of a previous run
+func (s *Spool) load() error {
+	paths, err := filepath.Glob(filepath.Join(s.opts.Dir, "*.seg"))
+	if err != nil {
+		return errors.E(err)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		var seq int64
+		if _, err := fmt.Sscanf(filepath.Base(path), "%016d.seg", &seq); err != nil {
+			continue
+		}
+		records, err := readSegment(path)
+		if err != nil {
+			log.Errorf("spool: segment %s is damaged, %d messages are readable: %s", path, len(records), err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return errors.E(err)
+		}
+		s.segments = append(s.segments, &spoolSegment{path: path, size: info.Size(), records: len(records)})
+		s.size += info.Size()
+		s.pending += len(records)
+		s.seq = seq
+	}
+	return nil
+}
+
+// Publish sends the message to the broker or spools it when the broker is unreachable.
+// Errors not caused by the connection, like a failed exchange declaration, are returned as is.
+func (s *Spool) Publish(c Config, publishing *amqp.Publishing) error {
+	// the claim check store must get the body before spooling, replay publishes the reference only
+	publishing, err := c.ClaimCheck.offload(context.Background(), publishing)
+	if err != nil {
+		return NewFatalError(err, nil)
+	}
+	check := c.ClaimCheck
+	c.ClaimCheck = nil
+
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+	if s.Pending() == 0 {
+		err = PublishMessage(c, publishing)
+		if err == nil || !isConnectionError(err) {
+			if err != nil {
+				check.discard(publishing)
+			}
+			return err
+		}
+		log.Warnf("spool: broker is unavailable, message %s is spooled: %s", publishing.MessageId, err)
+	}
+	if err := s.append(&spoolRecord{
+		Exchange:        c.Exchange,
+		RoutKey:         c.RoutKey,
+		ExchangeOptions: c.ExchangeOptions,
+		Publishing:      *publishing,
+	}); err != nil {
+		check.discard(publishing)
+		return NewFatalError(err, publishing.Body)
+	}
+	return nil
+}
+
+// Pending returns the number of spooled messages waiting for replay
+func (s *Spool) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+func (s *Spool) append(rec *spoolRecord) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(rec); err != nil {
+		return errors.Er(err, "spool: failed to encode message")
+	}
+	frame := make([]byte, spoolHeaderSize, spoolHeaderSize+payload.Len())
+	binary.BigEndian.PutUint32(frame[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	frame = append(frame, payload.Bytes()...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size+int64(len(frame)) > s.opts.MaxSize {
+		return errors.Errorf("%v: %d of %d bytes used", ErrSpoolFull, s.size, s.opts.MaxSize)
+	}
+	if s.writer == nil || s.segments[len(s.segments)-1].size+int64(len(frame)) > s.opts.SegmentSize {
+		if err := s.roll(); err != nil {
+			return err
+		}
+	}
+	seg := s.segments[len(s.segments)-1]
+	if _, err := s.writer.Write(frame); err != nil {
+		s.discardFrame(seg, int64(len(frame)))
+		return errors.Er(err, "spool: failed to write segment %s", seg.path)
+	}
+	if s.opts.Fsync == FsyncAlways {
+		if err := s.writer.Sync(); err != nil {
+			// the caller gets the error, so the message must not be replayed
+			s.discardFrame(seg, int64(len(frame)))
+			return errors.Er(err, "spool: failed to sync segment %s", seg.path)
+		}
+	}
+	s.spooled(seg, int64(len(frame)))
+	return nil
+}
+
+// spooled counts the frame appended to the segment, must be called with mu held
+func (s *Spool) spooled(seg *spoolSegment, size int64) {
+	seg.size += size
+	seg.records++
+	s.size += size
+	s.pending++
+	spoolMetrics.MsgsSpooled.Inc()
+	s.updateGaugesLocked()
+}
+
+// discardFrame truncates the failed frame and starts a new segment, must be called with mu held.
+// When the segment can't be truncated a complete frame is replayed, so the message may be published
+// although Publish returned an error.
+func (s *Spool) discardFrame(seg *spoolSegment, size int64) {
+	if err := s.writer.Truncate(seg.size); err != nil {
+		log.Errorf("spool: failed to truncate segment %s, the failed message may be published: %s", seg.path, err)
+		if info, err := s.writer.Stat(); err == nil && info.Size() == seg.size+size {
+			s.spooled(seg, size)
+		}
+	}
+	s.closeWriter()
+}
+
+// roll closes the current segment and starts a new one, must be called with mu held
+func (s *Spool) roll() error {
+	s.closeWriter()
+	s.seq++
+	path := filepath.Join(s.opts.Dir, fmt.Sprintf("%016d.seg", s.seq))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return errors.Er(err, "spool: failed to create segment")
+	}
+	s.writer = f
+	s.segments = append(s.segments, &spoolSegment{path: path})
+	return nil
+}
+
+// closeWriter makes the current segment read-only, must be called with mu held
+func (s *Spool) closeWriter() {
+	if s.writer == nil {
+		return
+	}
+	if s.opts.Fsync != FsyncNever {
+		if err := s.writer.Sync(); err != nil {
+			log.Errorf("spool: failed to sync segment %s: %s", s.writer.Name(), err)
+		}
+	}
+	utils.DeferCloseLog(s.writer)
+	s.writer = nil
+}
+
+func (s *Spool) sync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer != nil {
+		if err := s.writer.Sync(); err != nil {
+			log.Errorf("spool: failed to sync segment %s: %s", s.writer.Name(), err)
+		}
+	}
+}
+
+// Run replays spooled messages every ReplayInterval and syncs segments for FsyncInterval policy
+// until ctx is done.
+func (s *Spool) Run(ctx context.Context) error {
+	replay := time.NewTicker(s.opts.ReplayInterval)
+	defer replay.Stop()
+	var fsync <-chan time.Time
+	if s.opts.Fsync == FsyncInterval {
+		ticker := time.NewTicker(s.opts.FsyncInterval)
+		defer ticker.Stop()
+		fsync = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-fsync:
+			s.sync()
+		case <-replay.C:
+			if s.Pending() == 0 {
+				continue
+			}
+			if err := s.Replay(ctx); err != nil {
+				log.Warnf("spool: replay is paused, %d messages pending: %s", s.Pending(), err)
+			}
+		}
+	}
+}
+
+// Replay publishes spooled messages in order until the spool is empty or publishing fails
+func (s *Spool) Replay(ctx context.Context) error {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	for {
+		s.mu.Lock()
+		if len(s.segments) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		seg := s.segments[0]
+		if len(s.segments) == 1 && s.writer != nil {
+			// the segment must not change while it is replayed, new messages go to the next one
+			s.closeWriter()
+		}
+		s.mu.Unlock()
+
+		records, err := readSegment(seg.path)
+		if err != nil {
+			log.Errorf("spool: segment %s is damaged, %d messages are readable: %s", seg.path, len(records), err)
+		}
+		for seg.replayed < len(records) {
+			if err := s.publisher.publish(ctx, &s.conn, records[seg.replayed]); err != nil {
+				return err
+			}
+			seg.replayed++
+			s.mu.Lock()
+			s.pending--
+			spoolMetrics.MsgsReplayed.Inc()
+			s.updateGaugesLocked()
+			s.mu.Unlock()
+		}
+
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return errors.Er(err, "spool: failed to remove segment %s", seg.path)
+		}
+		s.mu.Lock()
+		s.segments = s.segments[1:]
+		s.size -= seg.size
+		// records lost in a damaged tail are not pending anymore
+		s.pending -= seg.records - seg.replayed
+		s.updateGaugesLocked()
+		s.mu.Unlock()
+	}
+}
+
+// Close syncs and closes the current segment and the replay connection
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	s.closeWriter()
+	s.mu.Unlock()
+	s.replayMu.Lock()
+	s.publisher.close()
+	s.replayMu.Unlock()
+	return nil
+}
+
+func (s *Spool) updateGauges() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateGaugesLocked()
+}
+
+func (s *Spool) updateGaugesLocked() {
+	spoolMetrics.SpoolBytes.Set(float64(s.size))
+	spoolMetrics.SpoolPending.Set(float64(s.pending))
+}
+
+// readSegment returns records of the segment, a damaged tail left by a crash stops reading with an error
+func readSegment(path string) ([]*spoolRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.E(err)
+	}
+	defer utils.DeferCloseLog(f)
+
+	var records []*spoolRecord
+	r := bufio.NewReader(f)
+	header := make([]byte, spoolHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return records, nil
+			}
+			return records, errors.Er(err, "truncated header")
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return records, errors.Er(err, "truncated message")
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return records, errors.New("checksum mismatch")
+		}
+		rec := &spoolRecord{}
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(rec); err != nil {
+			return records, errors.Er(err, "failed to decode message")
+		}
+		records = append(records, rec)
+	}
+}
+
+// spoolPublisher keeps a confirmed channel for replay
+type spoolPublisher struct {
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	declared map[string]bool
+}
+
+func (p *spoolPublisher) publish(ctx context.Context, cnf *Config, rec *spoolRecord) error {
+	if p.ch == nil || p.ch.IsClosed() {
+		if err := p.connect(cnf); err != nil {
+			return err
+		}
+	}
+	if !p.declared[rec.Exchange] {
+		err := p.ch.ExchangeDeclare(rec.Exchange,
+			rec.ExchangeOptions.Kind,
+			rec.ExchangeOptions.Durable,
+			rec.ExchangeOptions.AutoDelete,
+			rec.ExchangeOptions.Internal,
+			rec.ExchangeOptions.NoWait,
+			rec.ExchangeOptions.Args)
+		if err != nil {
+			p.close()
+			return errors.Errorf("spool: declare exchanger %s error: %v", rec.Exchange, err)
+		}
+		p.declared[rec.Exchange] = true
+	}
+	confirm, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, rec.Exchange, rec.RoutKey, false, false, rec.Publishing)
+	if err != nil {
+		p.close()
+		return errors.Errorf("spool: publish to %s, with routekey %s return error %v", rec.Exchange, rec.RoutKey, err)
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		p.close()
+		return errors.E(err)
+	}
+	if !acked {
+		return errors.Errorf("spool: message %s to %s is nacked by the broker", rec.Publishing.MessageId, rec.Exchange)
+	}
+	return nil
+}
+
+func (p *spoolPublisher) connect(cnf *Config) error {
+	p.close()
+	conn, err := cnf.Dial()
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		utils.DeferCloseLog(conn)
+		return errors.Errorf("spool: create Channel error: %v", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		utils.DeferCloseLog(conn)
+		return errors.Errorf("spool: enable confirms error: %v", err)
+	}
+	p.conn, p.ch = conn, ch
+	p.declared = map[string]bool{}
+	return nil
+}
+
+func (p *spoolPublisher) close() {
+	if p.conn != nil && !p.conn.IsClosed() {
+		utils.DeferCloseLog(p.conn)
+	}
+	p.conn, p.ch = nil, nil
+}
+
+// isConnectionError reports whether a publish failed because the broker is unreachable
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, amqp.ErrClosed) {
+		return true
+	}
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) {
+		return amqpErr.Code == amqp.ConnectionForced || amqpErr.Code == amqp.ChannelError
+	}
+	return false
+}
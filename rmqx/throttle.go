@@ -0,0 +1,284 @@
+package rmqx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitOptions configures a token bucket shared by all workers of a pool.
+// Rate is the number of messages per second handed to the handler, Burst is the bucket size.
+type RateLimitOptions struct {
+	Rate  float64 `yaml:"rate" env:"RABBITMQ_RATE_LIMIT" env-default:"10"`
+	Burst int     `yaml:"burst" env:"RABBITMQ_RATE_LIMIT_BURST" env-default:"1"`
+}
+
+// CircuitBreakerOptions configures the circuit breaker of a pool.
+//
+// While the circuit is closed the pool counts handler results in windows of Window duration.
+// When at least MinRequests messages were handled in the window and the share of failures
+// reaches FailureRatio the circuit opens and workers stop taking messages for OpenTimeout.
+// Unacked prefetched messages stay in the channel, so the broker does not deliver more.
+// After the cool-down the circuit becomes half-open and lets HalfOpenRequests messages through,
+// if all of them succeed the circuit closes, the first failure opens it again.
+type CircuitBreakerOptions struct {
+	FailureRatio     float64       `yaml:"failure_ratio" env:"RABBITMQ_CIRCUIT_FAILURE_RATIO" env-default:"0.5"`
+	MinRequests      int           `yaml:"min_requests" env:"RABBITMQ_CIRCUIT_MIN_REQUESTS" env-default:"10"`
+	Window           time.Duration `yaml:"window" env:"RABBITMQ_CIRCUIT_WINDOW" env-default:"1m"`
+	OpenTimeout      time.Duration `yaml:"open_timeout" env:"RABBITMQ_CIRCUIT_OPEN_TIMEOUT" env-default:"30s"`
+	HalfOpenRequests int           `yaml:"half_open_requests" env:"RABBITMQ_CIRCUIT_HALF_OPEN_REQUESTS" env-default:"1"`
+}
+
+func (o CircuitBreakerOptions) validate() error {
+	if o.FailureRatio <= 0 || o.FailureRatio > 1 {
+		return errors.New("circuit failure ratio must be in (0, 1]")
+	}
+	if o.MinRequests <= 0 {
+		return errors.New("circuit min requests must be greater than 0")
+	}
+	if o.Window <= 0 || o.OpenTimeout <= 0 {
+		return errors.New("circuit window and open timeout must be greater than 0")
+	}
+	if o.HalfOpenRequests <= 0 {
+		return errors.New("circuit half-open requests must be greater than 0")
+	}
+	return nil
+}
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// gate is consulted by a worker before and after handling each message
+type gate interface {
+	wait(ctx context.Context) error
+	done(err error)
+}
+
+type gatedWorker interface {
+	setGate(g gate)
+}
+
+// throttle combines optional rate limit and circuit breaker of a pool
+type throttle struct {
+	limiter *rate.Limiter
+	breaker *circuitBreaker
+}
+
+func (t *throttle) wait(ctx context.Context) error {
+	if t.breaker != nil {
+		if err := t.breaker.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if t.limiter != nil {
+		return t.limiter.Wait(ctx)
+	}
+	return nil
+}
+
+func (t *throttle) done(err error) {
+	if t.breaker != nil {
+		t.breaker.record(err == nil)
+	}
+}
+
+type circuitBreaker struct {
+	opts     CircuitBreakerOptions
+	queue    string
+	now      func() time.Time
+	mu       sync.Mutex
+	state    CircuitState
+	changed  chan struct{} // closed and replaced on every state change
+	window   time.Time
+	requests int
+	failures int
+	openedAt time.Time
+	probes   int
+	passed   int
+	onChange func(from, to CircuitState)
+}
+
+func newCircuitBreaker(opts CircuitBreakerOptions, queue string) *circuitBreaker {
+	return &circuitBreaker{
+		opts:    opts,
+		queue:   queue,
+		now:     time.Now,
+		changed: make(chan struct{}),
+	}
+}
+
+func (c *circuitBreaker) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// wait blocks while the circuit is open or all half-open probes are taken
+func (c *circuitBreaker) wait(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		switch c.state {
+		case CircuitClosed:
+			c.mu.Unlock()
+			return nil
+		case CircuitHalfOpen:
+			if c.probes < c.opts.HalfOpenRequests {
+				c.probes++
+				c.mu.Unlock()
+				return nil
+			}
+			changed := c.changed
+			c.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+			}
+		case CircuitOpen:
+			remaining := c.opts.OpenTimeout - c.now().Sub(c.openedAt)
+			if remaining <= 0 {
+				c.setState(CircuitHalfOpen)
+				c.mu.Unlock()
+				continue
+			}
+			changed := c.changed
+			c.mu.Unlock()
+			timer := time.NewTimer(remaining)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			case <-changed:
+				timer.Stop()
+			}
+		}
+	}
+}
+
+// record registers a handler result
+func (c *circuitBreaker) record(success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case CircuitClosed:
+		now := c.now()
+		if now.Sub(c.window) > c.opts.Window {
+			c.window, c.requests, c.failures = now, 0, 0
+		}
+		c.requests++
+		if !success {
+			c.failures++
+		}
+		if c.requests >= c.opts.MinRequests && float64(c.failures)/float64(c.requests) >= c.opts.FailureRatio {
+			c.setState(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		if !success {
+			c.setState(CircuitOpen)
+			return
+		}
+		c.passed++
+		if c.passed >= c.opts.HalfOpenRequests {
+			c.setState(CircuitClosed)
+		}
+	case CircuitOpen:
+		// result of a message taken before the circuit opened
+	}
+}
+
+// setState must be called with c.mu held
+func (c *circuitBreaker) setState(state CircuitState) {
+	from := c.state
+	now := c.now()
+	c.state = state
+	c.window, c.requests, c.failures = now, 0, 0
+	c.probes, c.passed = 0, 0
+	if state == CircuitOpen {
+		c.openedAt = now
+	}
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	log.Infof("circuit breaker of queue %s: %s -> %s", c.queue, from, state)
+	if workerMetrics != nil {
+		workerMetrics.CircuitState.WithLabelValues(c.queue).Set(float64(state))
+		workerMetrics.CircuitTransitions.WithLabelValues(c.queue, state.String()).Inc()
+	}
+	if c.onChange != nil {
+		go c.onChange(from, state)
+	}
+}
+
+// throttle returns the pool gate, creating it and attaching it to the workers on first use
+func (p *WorkerPool) throttle() *throttle {
+	if p.gate == nil {
+		p.gate = &throttle{}
+		for _, w := range p.workers {
+			if gw, ok := w.(gatedWorker); ok {
+				gw.setGate(p.gate)
+			}
+		}
+	}
+	return p.gate
+}
+
+// EnableRateLimit limits the number of messages per second handled by all workers of the pool.
+// It must be called before Start.
+func (p *WorkerPool) EnableRateLimit(opts RateLimitOptions) error {
+	if opts.Rate <= 0 {
+		return errors.New("rate limit must be greater than 0")
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.throttle().limiter = rate.NewLimiter(rate.Limit(opts.Rate), opts.Burst)
+	return nil
+}
+
+// EnableCircuitBreaker pauses consumption of the pool when the handler fails too often,
+// onChange (optional) is called on every state change. It must be called before Start.
+func (p *WorkerPool) EnableCircuitBreaker(opts CircuitBreakerOptions, onChange func(from, to CircuitState)) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	breaker := newCircuitBreaker(opts, p.config.QueName)
+	breaker.onChange = onChange
+	p.throttle().breaker = breaker
+	return nil
+}
+
+// CircuitState returns the state of the pool circuit breaker, it is always closed when the breaker is not enabled
+func (p *WorkerPool) CircuitState() CircuitState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.gate == nil || p.gate.breaker == nil {
+		return CircuitClosed
+	}
+	return p.gate.breaker.State()
+}
@@ -0,0 +1,82 @@
+package rmqx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	c := newCircuitBreaker(CircuitBreakerOptions{
+		FailureRatio:     0.5,
+		MinRequests:      4,
+		Window:           time.Minute,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+	}, "test")
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, ok := range []bool{true, false, true} {
+		c.record(ok)
+	}
+	if c.State() != CircuitClosed {
+		t.Fatalf("circuit opened before min requests, state %s", c.State())
+	}
+	c.record(false)
+	if c.State() != CircuitOpen {
+		t.Fatalf("expected open circuit, got %s", c.State())
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := c.wait(waitCtx); err == nil {
+		t.Fatal("open circuit let a message through")
+	}
+
+	now = now.Add(31 * time.Second)
+	if err := c.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.State() != CircuitHalfOpen {
+		t.Fatalf("expected half-open circuit, got %s", c.State())
+	}
+	probeCtx, cancelProbe := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelProbe()
+	if err := c.wait(probeCtx); err == nil {
+		t.Fatal("half-open circuit let more messages than probes through")
+	}
+
+	c.record(false)
+	if c.State() != CircuitOpen {
+		t.Fatalf("failed probe must open circuit, got %s", c.State())
+	}
+	now = now.Add(31 * time.Second)
+	if err := c.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.record(true)
+	if c.State() != CircuitClosed {
+		t.Fatalf("successful probe must close circuit, got %s", c.State())
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	now := time.Now()
+	c := newCircuitBreaker(CircuitBreakerOptions{
+		FailureRatio:     0.5,
+		MinRequests:      2,
+		Window:           time.Minute,
+		OpenTimeout:      time.Second,
+		HalfOpenRequests: 1,
+	}, "test")
+	c.now = func() time.Time { return now }
+
+	c.record(false)
+	now = now.Add(2 * time.Minute)
+	c.record(true)
+	if c.State() != CircuitClosed {
+		t.Fatalf("failures from previous window must be dropped, got %s", c.State())
+	}
+}
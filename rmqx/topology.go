@@ -0,0 +1,150 @@
+package rmqx
+
+import (
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// QueueRole identifies an auxiliary queue of retry and repeat pools
+type QueueRole string
+
+const (
+	// RetryQueue holds rejected messages of a retry pool until the TTL expires
+	RetryQueue QueueRole = "retry"
+	// WaitQueue holds messages of a repeat pool until the per-message expiration
+	WaitQueue QueueRole = "wait"
+	// FailQueue collects messages which ran out of attempts
+	FailQueue QueueRole = "fail"
+)
+
+// Topology is a naming strategy for the exchange and queues retry and repeat pools declare
+// next to the main queue. Pool constructors, rejectors and Router use the same strategy,
+// so a custom one can map rmqx onto an existing broker layout.
+type Topology interface {
+	// RetryExchange returns name and kind of the exchange routing messages to the auxiliary queues
+	RetryExchange(cnf *Config) (name, kind string)
+	// Queue returns the name of the auxiliary queue and the key binding it to the retry exchange
+	Queue(cnf *Config, role QueueRole) (name, bindingKey string)
+}
+
+// TopologyOptions is the default Topology which appends suffixes to the main exchange,
+// queue and routing key names, empty fields fall back to the defaults.
+type TopologyOptions struct {
+	RetryExchangeSuffix string `yaml:"retry_exchange_suffix" env:"RABBITMQ_RETRY_EXCHANGE_SUFFIX" env-default:".topic"`
+	RetryExchangeKind   string `yaml:"retry_exchange_kind" env:"RABBITMQ_RETRY_EXCHANGE_KIND"` // empty - kind of the main exchange
+	RetrySuffix         string `yaml:"retry_suffix" env:"RABBITMQ_RETRY_SUFFIX" env-default:".retry"`
+	WaitSuffix          string `yaml:"wait_suffix" env:"RABBITMQ_WAIT_SUFFIX" env-default:".wait"`
+	FailSuffix          string `yaml:"fail_suffix" env:"RABBITMQ_FAIL_SUFFIX" env-default:".fail"`
+}
+
+func (t TopologyOptions) RetryExchange(cnf *Config) (string, string) {
+	kind := t.RetryExchangeKind
+	if kind == "" {
+		kind = cnf.ExchangeOptions.Kind
+	}
+	return cnf.Exchange + orDefault(t.RetryExchangeSuffix, ".topic"), kind
+}
+
+func (t TopologyOptions) Queue(cnf *Config, role QueueRole) (string, string) {
+	var suffix string
+	switch role {
+	case RetryQueue:
+		suffix = orDefault(t.RetrySuffix, ".retry")
+	case WaitQueue:
+		suffix = orDefault(t.WaitSuffix, ".wait")
+	default:
+		suffix = orDefault(t.FailSuffix, ".fail")
+	}
+	return cnf.QueName + suffix, cnf.RoutKey + suffix
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// topology returns the naming strategy of the config
+func (c *Config) topology() Topology {
+	if c.Topology != nil {
+		return c.Topology
+	}
+	return c.TopologyOptions
+}
+
+// AuxQueueName returns the name of the auxiliary queue for the role given by the config topology
+func (c *Config) AuxQueueName(role QueueRole) string {
+	name, _ := c.topology().Queue(c, role)
+	return name
+}
+
+type auxQueue struct {
+	role QueueRole
+	args amqp.Table
+}
+
+// declareAuxQueues declares the retry exchange and the auxiliary queues bound to it
+func declareAuxQueues(ch *amqp.Channel, cnf *Config, queues ...auxQueue) error {
+	topology := cnf.topology()
+	exchange, kind := topology.RetryExchange(cnf)
+	err := ch.ExchangeDeclare(
+		exchange,
+		kind,
+		cnf.ExchangeOptions.Durable,
+		cnf.ExchangeOptions.AutoDelete,
+		cnf.ExchangeOptions.Internal,
+		cnf.ExchangeOptions.NoWait,
+		cnf.ExchangeOptions.Args)
+	if err != nil {
+		return errors.Errorf("NewWorker amqp declare exchanger %s error: %s", exchange, err)
+	}
+	for _, q := range queues {
+		name, key := topology.Queue(cnf, q.role)
+		_, err = ch.QueueDeclare(name,
+			cnf.QueueOptions.Durable,
+			cnf.QueueOptions.AutoDelete,
+			cnf.QueueOptions.Exclusive,
+			cnf.QueueOptions.NoWait,
+			q.args)
+		if err != nil {
+			return errors.Errorf("can't declare queue %s: %s", name, err)
+		}
+		err = ch.QueueBind(name, key, exchange, false, nil)
+		if err != nil {
+			return errors.Errorf("can't bind queue %s to %s with key %s: %s", name, exchange, key, err)
+		}
+	}
+	return nil
+}
+
+// republishConfig returns the config of the auxiliary queue of the role, it dials like cnf,
+// with its nodes, TLS and credentials
+func republishConfig(cnf *Config, role QueueRole) Config {
+	topology := cnf.topology()
+	c := *cnf
+	c.Exchange, c.ExchangeOptions.Kind = topology.RetryExchange(cnf)
+	_, c.RoutKey = topology.Queue(cnf, role)
+	// the body of a claim checked delivery is already the reference, and a failed publish
+	// must not discard the stored body the delivery still refers to
+	c.ClaimCheck = nil
+	return c
+}
+
+// republish sends a copy of the delivery to the auxiliary queue
+func republish(cnf *Config, role QueueRole, delivery *amqp.Delivery, expiration string) error {
+	return PublishMessage(republishConfig(cnf, role), &amqp.Publishing{
+		Headers:         delivery.Headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		Expiration:      expiration,
+		MessageId:       delivery.MessageId,
+		Timestamp:       time.Time{},
+		Type:            delivery.Type,
+		UserId:          delivery.UserId,
+		AppId:           delivery.AppId,
+		Body:            delivery.Body,
+	})
+}
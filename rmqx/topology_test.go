@@ -0,0 +1,68 @@
+package rmqx
+
+import "testing"
+
+func TestTopologyOptions(t *testing.T) {
+	cnf := &Config{
+		Exchange:        "orders",
+		RoutKey:         "order.created",
+		QueName:         "billing",
+		ExchangeOptions: ExchangeOptions{Kind: "direct"},
+	}
+
+	exchange, kind := cnf.topology().RetryExchange(cnf)
+	if exchange != "orders.topic" || kind != "direct" {
+		t.Errorf("unexpected default retry exchange %s (%s)", exchange, kind)
+	}
+	name, key := cnf.topology().Queue(cnf, FailQueue)
+	if name != "billing.fail" || key != "order.created.fail" {
+		t.Errorf("unexpected default fail queue %s, key %s", name, key)
+	}
+
+	cnf.TopologyOptions = TopologyOptions{
+		RetryExchangeSuffix: ".dlx",
+		RetryExchangeKind:   "topic",
+		RetrySuffix:         ".delayed",
+	}
+	exchange, kind = cnf.topology().RetryExchange(cnf)
+	if exchange != "orders.dlx" || kind != "topic" {
+		t.Errorf("unexpected retry exchange %s (%s)", exchange, kind)
+	}
+	name, key = cnf.topology().Queue(cnf, RetryQueue)
+	if name != "billing.delayed" || key != "order.created.delayed" {
+		t.Errorf("unexpected retry queue %s, key %s", name, key)
+	}
+	name, _ = cnf.topology().Queue(cnf, WaitQueue)
+	if name != "billing.wait" {
+		t.Errorf("empty suffix must fall back to default, got %s", name)
+	}
+}
+
+func TestRepublishConfig(t *testing.T) {
+	cnf := &Config{
+		ConnectionUrl:   "amqps://a,amqps://b",
+		NodeSelection:   NodeShuffle,
+		Exchange:        "orders",
+		RoutKey:         "order.created",
+		QueName:         "billing",
+		PasswordFile:    "/run/secrets/rabbitmq",
+		TLS:             TLSOptions{CAFile: "ca.pem"},
+		ExchangeOptions: ExchangeOptions{Kind: "direct", Durable: true},
+		TopologyOptions: TopologyOptions{RetryExchangeKind: "topic"},
+		ClaimCheck:      &ClaimCheck{},
+	}
+	c := republishConfig(cnf, FailQueue)
+	if c.Exchange != "orders.topic" || c.ExchangeOptions.Kind != "topic" || c.RoutKey != "order.created.fail" {
+		t.Errorf("unexpected fail queue route %s (%s) %s", c.Exchange, c.ExchangeOptions.Kind, c.RoutKey)
+	}
+	if c.ConnectionUrl != cnf.ConnectionUrl || c.NodeSelection != NodeShuffle || c.PasswordFile != cnf.PasswordFile ||
+		c.TLS != cnf.TLS || !c.ExchangeOptions.Durable {
+		t.Errorf("the connection settings must be kept %+v", c)
+	}
+	if c.ClaimCheck != nil {
+		t.Error("the reference of a claim checked delivery must not be offloaded again")
+	}
+	if cnf.Exchange != "orders" || cnf.ExchangeOptions.Kind != "direct" {
+		t.Error("the config of the worker must not change")
+	}
+}
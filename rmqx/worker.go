@@ -8,6 +8,7 @@ import (
 	"github.com/C0nstantin/pkg/utils"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"math/rand"
+	"time"
 )
 
 type internalError struct {
@@ -31,6 +32,24 @@ func NewFatalError(err error, msg []byte) error {
 	return &FatalError{err: err, msg: msg}
 }
 
+// RejectError makes the worker reject the message without requeue, bypassing the pool Rejector,
+// so it is not retried
+type RejectError struct {
+	err error
+}
+
+func (r RejectError) Error() string {
+	return fmt.Sprintf("message rejected: %s", r.err)
+}
+
+func (r RejectError) Unwrap() error {
+	return r.err
+}
+
+func NewRejectError(err error) error {
+	return &RejectError{err: err}
+}
+
 type baseWorker struct {
 	name            string
 	config          *Config
@@ -39,6 +58,7 @@ type baseWorker struct {
 	msgs            <-chan amqp.Delivery
 	notifyCloseConn chan *amqp.Error
 	notifyCloseChan chan *amqp.Error
+	notifyCancel    chan string
 	fatalErrors     chan error
 	handler         Handler
 	rejector        Rejector
@@ -46,6 +66,9 @@ type baseWorker struct {
 	errors          chan internalError
 	logger          log.Logger
 	errorHandler    ErrorHandler
+	gate            gate
+	// resubscribe declares the queue and consumes it again after the consumer cancellation
+	resubscribe func() error
 }
 
 func NewWorker(name string, config *Config, conn *amqp.Connection, handler Handler, rejector Rejector, errorHandler ErrorHandler) (Worker, error) {
@@ -56,7 +79,7 @@ func NewWorker(name string, config *Config, conn *amqp.Connection, handler Handl
 	logger := log.NewLogger()
 	logger.AddField("worker", name)
 
-	return &baseWorker{
+	w := &baseWorker{
 		name:            name,
 		config:          config,
 		conn:            conn,
@@ -69,8 +92,9 @@ func NewWorker(name string, config *Config, conn *amqp.Connection, handler Handl
 		fatalErrors:     make(chan error),
 		logger:          logger,
 		errorHandler:    errorHandler,
-	}, nil
-
+	}
+	w.resubscribe = w.redeclare
+	return w, nil
 }
 
 func (b *baseWorker) Run(ctx context.Context) error {
@@ -80,11 +104,24 @@ func (b *baseWorker) Run(ctx context.Context) error {
 	}
 	b.logger.Infof("✅ Start consume que %s, exchange %s, routing key %s", b.config.QueName, b.config.Exchange, b.config.RoutKey)
 	go func() {
+		var fatal error
 		select {
 		case err := <-b.notifyCloseChan:
-			b.fatalErrors <- fmt.Errorf("%s, %w", ErrChanelClosed, err)
+			if err == nil { // channel closed by worker itself
+				return
+			}
+			fatal = fmt.Errorf("%s, %w", ErrChanelClosed, err)
 		case err := <-b.notifyCloseConn:
-			b.fatalErrors <- fmt.Errorf("%s %w", ErrConnectionClosed, err)
+			if err == nil {
+				return
+			}
+			fatal = fmt.Errorf("%s %w", ErrConnectionClosed, err)
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case b.fatalErrors <- fatal:
+		case <-ctx.Done():
 		}
 	}()
 	go b.run(ctx)
@@ -100,7 +137,22 @@ func (b *baseWorker) Run(ctx context.Context) error {
 		case err := <-b.errors:
 			b.logger.Printf("handler error: %s  try rejected", err.err)
 			workerMetrics.MsgsRejected.Inc()
-			b.Reject(err)
+			if err := b.Reject(err); err != nil {
+				b.logger.Errorf("fatal error in worker: %s", err)
+				b.logger.Info("worker closing")
+				utils.DeferCloseLog(b)
+				return err
+			}
+		case tag, ok := <-b.notifyCancel:
+			if !ok { // channel closed, reported by notifyCloseChan
+				b.notifyCancel = nil
+				continue
+			}
+			if err := b.canceled(ctx, tag); err != nil {
+				b.logger.Errorf("fatal error in worker: %s", err)
+				utils.DeferCloseLog(b)
+				return err
+			}
 		case err := <-b.fatalErrors:
 			b.logger.Errorf("fatal error in worker: %s", err)
 			b.logger.Errorf("trace error %+v", err)
@@ -112,14 +164,20 @@ func (b *baseWorker) Run(ctx context.Context) error {
 }
 
 func (b *baseWorker) Handle(ctx context.Context, msg *amqp.Delivery) {
-	errChan := make(chan error)
-	done := make(chan struct{})
+	errChan := make(chan error, 1)
+	done := make(chan struct{}, 1)
 	go func() {
 		err := b.handler.Handle(msg, b.logger)
+		if b.gate != nil {
+			b.gate.done(err)
+		}
 		var e *FatalError
 		if errors.As(err, &e) {
 			_ = msg.Reject(false)
-			b.fatalErrors <- e
+			select {
+			case b.fatalErrors <- e:
+			case <-ctx.Done():
+			}
 			return
 		}
 		if err != nil {
@@ -131,8 +189,11 @@ func (b *baseWorker) Handle(ctx context.Context, msg *amqp.Delivery) {
 
 	select {
 	case err := <-errChan:
-		b.errors <- internalError{err: err, msg: msg}
 		b.logger.Errorf("Error handle message: %s", err)
+		select {
+		case b.errors <- internalError{err: err, msg: msg}:
+		case <-ctx.Done():
+		}
 		return
 
 	case <-ctx.Done():
@@ -144,16 +205,25 @@ func (b *baseWorker) Handle(ctx context.Context, msg *amqp.Delivery) {
 		err := msg.Ack(false)
 		if err != nil {
 			b.logger.Errorf("Error ack message: %s", err)
-			b.fatalErrors <- err
+			select {
+			case b.fatalErrors <- err:
+			case <-ctx.Done():
+			}
 			return
 		}
-		b.done <- msg
+		if o, ok := b.handler.(ackObserver); ok {
+			o.acked(msg)
+		}
+		select {
+		case b.done <- msg:
+		case <-ctx.Done():
+		}
 	}
 }
 
 func (b *baseWorker) Close() error {
 	b.logger.Infof("✅ Stop consume que %s", b.config.QueName)
-	if !b.channel.IsClosed() {
+	if b.channel != nil && !b.channel.IsClosed() {
 		err := b.channel.Close()
 		if err != nil {
 			b.logger.Errorf("failed to close channel:  %s", err)
@@ -179,6 +249,11 @@ func (b *baseWorker) connect() error {
 
 	b.notifyCloseConn = b.conn.NotifyClose(make(chan *amqp.Error))
 	b.notifyCloseChan = b.channel.NotifyClose(make(chan *amqp.Error))
+	b.notifyCancel = b.channel.NotifyCancel(make(chan string, 1))
+	return b.consume()
+}
+
+func (b *baseWorker) consume() error {
 	messages, err := b.channel.Consume(
 		b.config.QueName,
 		b.name,
@@ -194,21 +269,83 @@ func (b *baseWorker) connect() error {
 	return nil
 }
 
+// cancelRetries is the number of attempts to consume again after the consumer cancellation,
+// the attempt n waits n*cancelBackoff after the failure
+const cancelRetries = 5
+
+var cancelBackoff = time.Second
+
+// redeclare declares the queue with its own channel, so a failure does not close the worker one, and consumes
+func (b *baseWorker) redeclare() error {
+	if err := initSimpleQue(b.conn, b.config); err != nil {
+		return err
+	}
+	return b.consume()
+}
+
+// canceled handles basic.cancel the broker sends when the queue is deleted or the leader of a quorum
+// queue moves, it declares the queue again and consumes unless the policy is CancelFatal
+func (b *baseWorker) canceled(ctx context.Context, tag string) error {
+	queue := b.config.QueName
+	b.logger.Warnf("consumer %s of queue %s is canceled by the broker", tag, queue)
+	if b.config.ConsumeOptions.OnCancel == CancelFatal {
+		workerMetrics.ConsumerCancels.WithLabelValues(queue, "fatal").Inc()
+		return errors.Errorf("%v consumer %s of queue %s", ErrConsumerCanceled, tag, queue)
+	}
+	var err error
+	for attempt := 1; attempt <= cancelRetries; attempt++ {
+		err = b.resubscribe()
+		if err == nil {
+			workerMetrics.ConsumerCancels.WithLabelValues(queue, "recovered").Inc()
+			b.logger.Infof("✅ Consume que %s again", queue)
+			go b.run(ctx)
+			return nil
+		}
+		b.logger.Warnf("failed to consume que %s again, attempt %d: %s", queue, attempt, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Duration(attempt) * cancelBackoff):
+		}
+	}
+	workerMetrics.ConsumerCancels.WithLabelValues(queue, "failed").Inc()
+	return errors.Errorf("%v consumer %s of queue %s is not restored: %v", ErrConsumerCanceled, tag, queue, err)
+}
+
 func (b *baseWorker) run(ctx context.Context) {
 	for msg := range b.msgs {
 		workerMetrics.MsgsReceived.Inc()
+		if b.gate != nil {
+			// message stays unacked while the worker waits, it is redelivered if the worker stops
+			if err := b.gate.wait(ctx); err != nil {
+				return
+			}
+		}
 		b.Handle(ctx, &msg)
 
 	}
 }
 
-func (b *baseWorker) Reject(e internalError) {
+func (b *baseWorker) setGate(g gate) {
+	b.gate = g
+}
+
+// Reject passes the failed message to the rejector, the returned error is fatal for the worker,
+// it is returned to Run instead of fatalErrors which only Run reads
+func (b *baseWorker) Reject(e internalError) error {
 	//handle error
 	if b.errorHandler != nil {
 		b.errorHandler.ErrorHandle(e.err, e.msg)
 	}
-	err := b.rejector.Reject(e.msg)
-	if err != nil {
-		b.fatalErrors <- errors.Errorf("failed to reject message: %v", err)
+	var r *RejectError
+	if errors.As(e.err, &r) {
+		if err := e.msg.Reject(false); err != nil {
+			return errors.Errorf("failed to reject message: %v", err)
+		}
+		return nil
+	}
+	if err := b.rejector.Reject(e.msg); err != nil {
+		return errors.Errorf("failed to reject message: %v", err)
 	}
+	return nil
 }
@@ -4,60 +4,216 @@ import (
 	"context"
 	"fmt"
 	"github.com/C0nstantin/pkg/errors"
+	"github.com/C0nstantin/pkg/log"
+	"github.com/C0nstantin/pkg/transport/rabbitmq/dial"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"sync"
 )
 
+// workerFactory creates a named worker consuming through conn with the given handler
+type workerFactory func(conn *amqp.Connection, name string, handler Handler) (Worker, error)
+
 type WorkerPool struct {
-	workers []Worker
-	conn    *amqp.Connection
-	wg      *sync.WaitGroup
+	workers   []Worker
+	cancels   []context.CancelFunc
+	conn      *amqp.Connection
+	node      string
+	wg        *sync.WaitGroup
+	mu        sync.Mutex
+	config    *Config
+	handler   Handler
+	newWorker workerFactory
+	seq       int
+	stats     *poolStats
+	autoscale *AutoscaleOptions
+	gate      *throttle
+	single    *singleActive
 }
 
-func (p *WorkerPool) Start(ctx context.Context) error {
+func newWorkerPool(conn *amqp.Connection, node string, config *Config, handler Handler, factory workerFactory) *WorkerPool {
+	return &WorkerPool{
+		conn:      conn,
+		node:      node,
+		config:    config,
+		handler:   handler,
+		newWorker: factory,
+		stats:     &poolStats{},
+	}
+}
+
+// addWorkers creates n new workers, they are not started until Start is called
+func (p *WorkerPool) addWorkers(n int) error {
+	for i := 0; i < n; i++ {
+		worker, err := p.spawn()
+		if err != nil {
+			return err
+		}
+		p.workers = append(p.workers, worker)
+	}
+	return nil
+}
+
+func (p *WorkerPool) spawn() (Worker, error) {
+	var handler Handler = &trackedHandler{handler: p.handler, stats: p.stats}
+	if p.config.ClaimCheck != nil {
+		handler = &claimCheckHandler{handler: handler, check: p.config.ClaimCheck}
+	}
+	worker, err := p.newWorker(p.conn, fmt.Sprintf("worker-%d", p.seq), handler)
+	if err != nil {
+		return nil, err
+	}
+	p.seq++
+	if gw, ok := worker.(gatedWorker); ok && p.gate != nil {
+		gw.setGate(p.gate)
+	}
+	return worker, nil
+}
+
+// runWorker starts worker in its own goroutine and returns the function which stops it,
+// it is called with the pool locked
+func (p *WorkerPool) runWorker(ctx context.Context, worker Worker, errChan chan<- error) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	conn, failover := p.conn, p.config.failover()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := worker.Run(ctx)
+		if failover && conn.IsClosed() {
+			return // the pool reconnects to another node
+		}
+		if err != nil {
+			select {
+			case errChan <- err:
+			default:
+			}
+		}
+	}()
+	return cancel
+}
 
-	errChan := make(chan error, len(p.workers))
+func (p *WorkerPool) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p.mu.Lock()
+	size := len(p.workers)
+	if p.autoscale != nil && p.autoscale.MaxWorkers > size {
+		size = p.autoscale.MaxWorkers
+	}
+	errChan := make(chan error, size)
 	if p.wg == nil {
 		p.wg = &sync.WaitGroup{}
 	}
-	for _, worker := range p.workers {
-		p.wg.Add(1)
-		go func(w Worker) {
-			defer p.wg.Done()
-			err := w.Run(ctx)
+	p.cancels = make([]context.CancelFunc, len(p.workers))
+	if p.single == nil {
+		for i, worker := range p.workers {
+			p.cancels[i] = p.runWorker(ctx, worker, errChan)
+		}
+	}
+	p.mu.Unlock()
+
+	initMetrics()
+	go serveMetrics()
+	if p.gate != nil && p.gate.breaker != nil {
+		workerMetrics.CircuitState.WithLabelValues(p.config.QueName).Set(float64(p.gate.breaker.State()))
+	}
+	if p.single != nil {
+		workerMetrics.ActiveConsumer.WithLabelValues(p.config.QueName).Set(0)
+		go p.lead(ctx, errChan)
+	}
+	if p.autoscale != nil {
+		go p.runAutoscaler(ctx, errChan)
+	}
+	closed := p.notifyClose()
+	for {
+		select {
+		case <-ctx.Done():
+			err := p.Stop()
 			if err != nil {
-				errChan <- err
-				return
+				return err
+			}
+			return nil
+		case err := <-errChan:
+			return errors.E(err)
+		case amqpErr := <-closed:
+			if amqpErr == nil { // closed by Stop
+				closed = nil
+				continue
 			}
-		}(worker)
+			log.Warnf("connection to %s of queue %s lost: %s, reconnecting", p.ConnectedNode(), p.config.QueName, amqpErr)
+			if err := p.reconnect(ctx, errChan); err != nil {
+				return err
+			}
+			closed = p.notifyClose()
+		}
+	}
+}
+
+// notifyClose returns the channel reporting the connection loss when the config lists several nodes
+func (p *WorkerPool) notifyClose() chan *amqp.Error {
+	if !p.config.failover() {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn.NotifyClose(make(chan *amqp.Error, 1))
+}
+
+// reconnect connects to the next available node and replaces the workers of the lost connection,
+// the queue must be replicated or declared on the new node
+func (p *WorkerPool) reconnect(ctx context.Context, errChan chan<- error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, cancel := range p.cancels {
+		if cancel != nil {
+			cancel()
+			p.cancels[i] = nil
+		}
+	}
+	conn, node, err := p.config.dial()
+	if err != nil {
+		return err
 	}
-	go func() { initMetrics() }()
-	select {
-	case <-ctx.Done():
-		err := p.Stop()
+	p.conn, p.node = conn, node
+	for i := range p.workers {
+		worker, err := p.spawn()
 		if err != nil {
 			return err
 		}
-		return nil
-	case err := <-errChan:
-		return errors.E(err)
+		p.workers[i] = worker
+		// in single active consumer mode the workers run when the lock is acquired on the new connection
+		if p.single == nil {
+			p.cancels[i] = p.runWorker(ctx, worker, errChan)
+		}
 	}
+	log.Infof("queue %s reconnected to %s", p.config.QueName, dial.RedactURL(node))
+	return nil
 }
 
-func (p *WorkerPool) Stop() (err error) {
+// ConnectedNode returns the url, without the password, of the node the pool consumes from
+func (p *WorkerPool) ConnectedNode() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return dial.RedactURL(p.node)
+}
 
-	if !p.conn.IsClosed() {
-		err = p.conn.Close()
+func (p *WorkerPool) Stop() (err error) {
+	p.mu.Lock()
+	conn := p.conn
+	p.mu.Unlock()
+	if !conn.IsClosed() {
+		err = conn.Close()
 		if err != nil {
 			fmt.Printf("failed to close connection:  %s", err)
 		}
 	}
+	p.mu.Lock()
 	for _, worker := range p.workers {
 		err := worker.Close()
 		if err != nil {
 			fmt.Printf("failed to close worker:  %s", err)
 		}
 	}
+	p.mu.Unlock()
 	p.wg.Wait()
 	return err
 }
@@ -73,7 +229,7 @@ func initSimpleQue(conn *amqp.Connection, config *Config) error {
 		config.QueueOptions.AutoDelete,
 		config.QueueOptions.Exclusive,
 		config.QueueOptions.NoWait,
-		config.QueueOptions.Args)
+		config.QueueOptions.args())
 	if err != nil {
 		return errors.E(err)
 	}
@@ -89,15 +245,18 @@ func initSimpleQue(conn *amqp.Connection, config *Config) error {
 		if err != nil {
 			return errors.E(err)
 		}
+	}
+	// exchanges other than config.Exchange must already exist
+	for _, b := range config.bindings() {
 		err = channel.QueueBind(
 			config.QueName,
-			config.RoutKey,
-			config.Exchange,
+			b.RoutingKey,
+			b.Exchange,
 			false,
-			nil)
-	}
-	if err != nil {
-		return errors.E(err)
+			b.Args)
+		if err != nil {
+			return errors.Errorf("can't bind queue %s to %s with key %s: %v", config.QueName, b.Exchange, b.RoutingKey, err)
+		}
 	}
 	err = channel.Close()
 	if err != nil {
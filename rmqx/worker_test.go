@@ -0,0 +1,90 @@
+package rmqx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/C0nstantin/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestWorker_canceledFatal(t *testing.T) {
+	initMetrics()
+	cnf := &Config{QueName: "jobs", ConsumeOptions: ConsumeOptions{OnCancel: CancelFatal}}
+	w, err := NewWorker("w", cnf, nil, &EmptyHandler{}, &EmptyRejector{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.(*baseWorker).canceled(context.Background(), "w")
+	if !errors.Is(err, ErrConsumerCanceled) {
+		t.Errorf("expected ErrConsumerCanceled, got %v", err)
+	}
+}
+
+func TestWorker_canceledReconsume(t *testing.T) {
+	initMetrics()
+	defer func(backoff time.Duration) { cancelBackoff = backoff }(cancelBackoff)
+	cancelBackoff = time.Millisecond
+	cnf := &Config{QueName: "jobs", ConsumeOptions: ConsumeOptions{OnCancel: CancelReconsume}}
+	w, err := NewWorker("w", cnf, nil, &EmptyHandler{}, &EmptyRejector{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker := w.(*baseWorker)
+
+	var attempts int
+	worker.resubscribe = func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("queue is not available")
+		}
+		msgs := make(chan amqp.Delivery)
+		close(msgs)
+		worker.msgs = msgs
+		return nil
+	}
+	if err := worker.canceled(context.Background(), "w"); err != nil || attempts != 3 {
+		t.Errorf("consumer must be restored on the third attempt, got %d attempts: %v", attempts, err)
+	}
+
+	attempts = 0
+	worker.resubscribe = func() error {
+		attempts++
+		return errors.New("queue is not available")
+	}
+	err = worker.canceled(context.Background(), "w")
+	if !errors.Is(err, ErrConsumerCanceled) || attempts != cancelRetries {
+		t.Errorf("expected ErrConsumerCanceled after %d attempts, got %d: %v", cancelRetries, attempts, err)
+	}
+
+	cancelBackoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	if err := worker.canceled(ctx, "w"); err != nil || attempts != 1 {
+		t.Errorf("stopped worker must not retry, got %d attempts: %v", attempts, err)
+	}
+}
+
+// failingAcknowledger fails every acknowledgement, as on a closed channel
+type failingAcknowledger struct{}
+
+func (failingAcknowledger) Ack(uint64, bool) error        { return amqp.ErrClosed }
+func (failingAcknowledger) Nack(uint64, bool, bool) error { return amqp.ErrClosed }
+func (failingAcknowledger) Reject(uint64, bool) error     { return amqp.ErrClosed }
+
+func TestWorker_Reject(t *testing.T) {
+	initMetrics()
+	w, err := NewWorker("w", &Config{QueName: "jobs"}, nil, &EmptyHandler{}, &EmptyRejector{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &amqp.Delivery{Acknowledger: failingAcknowledger{}}
+	for _, e := range []error{NewRejectError(errors.New("invalid message")), errors.New("handle error")} {
+		err := w.(*baseWorker).Reject(internalError{err: e, msg: msg})
+		if !errors.Is(err, amqp.ErrClosed) {
+			t.Errorf("failed reject of %q must be returned, got %v", e, err)
+		}
+	}
+}
@@ -52,3 +52,21 @@ func (b *BaseController) Abort(ctx *gin.Context, err error) {
 	// logs.Printf("%+v", err)
 	_ = ctx.Error(err)
 }
+
+// Protect returns the routes behind the auth middleware and middlewares, it is used by controllers
+// which can be mounted outside of an HTTPServe with Auth. A router gets a group, so the other
+// routes are not affected, auth may be nil.
+func Protect(r gin.IRoutes, auth Auth, middlewares ...gin.HandlerFunc) gin.IRoutes {
+	var handlers []gin.HandlerFunc
+	if auth != nil {
+		handlers = append(handlers, auth.AuthMiddleware())
+	}
+	handlers = append(handlers, middlewares...)
+	if len(handlers) == 0 {
+		return r
+	}
+	if router, ok := r.(gin.IRouter); ok {
+		return router.Group("", handlers...)
+	}
+	return r.Use(handlers...)
+}
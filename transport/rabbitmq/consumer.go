@@ -0,0 +1,274 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AckConsumer consumes events with manual acks, an event which is not acked
+// before the connection is lost is delivered again
+type AckConsumer interface {
+	Consume(ctx context.Context, opts ConsumeOptions, r chan<- *Delivery) error
+	ConsumeFunc(ctx context.Context, opts ConsumeOptions, handler func(ctx context.Context, d *Delivery) error) error
+}
+
+// QueueOptions configures the queue declared by Consume
+type QueueOptions struct {
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+	Expires    time.Duration // x-expires, the queue is removed after it is unused for this time, 0 - never
+	Args       amqp.Table
+}
+
+func (o QueueOptions) args() amqp.Table {
+	args := amqp.Table{}
+	for k, v := range o.Args {
+		args[k] = v
+	}
+	if o.Expires > 0 {
+		args["x-expires"] = o.Expires.Milliseconds()
+	}
+	return args
+}
+
+// RepeatHeader is the header with the number of times ConsumeFunc returned the failed event to the queue
+const RepeatHeader = "repeat_number"
+
+// ConsumeOptions sets the queue, the binding keys to the exchange of the transport
+// and the number of unacked events the broker sends before waiting for acks
+type ConsumeOptions struct {
+	Queue string // empty - the broker generates the name, it changes on reconnect
+	Keys  []string
+	QueueOptions
+	Prefetch int // 0 - unlimited
+	// MaxRepeat is the number of times ConsumeFunc returns a failed event to the queue, 0 - once, negative - never
+	MaxRepeat int
+}
+
+func (o ConsumeOptions) maxRepeat() int {
+	if o.MaxRepeat == 0 {
+		return 1
+	}
+	return o.MaxRepeat
+}
+
+// Delivery is a consumed event, it must be acked or nacked
+type Delivery struct {
+	Body        []byte
+	RoutingKey  string
+	Headers     amqp.Table
+	Redelivered bool
+	delivery    amqp.Delivery
+	ch          channel
+	queue       string
+}
+
+// Ack tells the broker the event is handled
+func (d *Delivery) Ack() error {
+	return d.delivery.Ack(false)
+}
+
+// Nack returns the event to the queue or, without requeue, drops it or sends it to the dead letter exchange of the queue
+func (d *Delivery) Nack(requeue bool) error {
+	return d.delivery.Nack(false, requeue)
+}
+
+// Repeat returns the number of times ConsumeFunc returned the event to the queue
+func (d *Delivery) Repeat() int {
+	switch n := d.Headers[RepeatHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// repeat publishes the event to the end of its queue with the next RepeatHeader and acks it,
+// the routing key of the copy is the queue name
+func (d *Delivery) repeat(ctx context.Context) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[RepeatHeader] = int32(d.Repeat() + 1)
+	err := d.ch.PublishWithContext(ctx, "", d.queue, false, false, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.delivery.ContentType,
+		ContentEncoding: d.delivery.ContentEncoding,
+		DeliveryMode:    d.delivery.DeliveryMode,
+		MessageId:       d.delivery.MessageId,
+		Type:            d.delivery.Type,
+		AppId:           d.delivery.AppId,
+		Body:            d.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("publish to queue %s error: %w", d.queue, err)
+	}
+	return d.Ack()
+}
+
+// Consume declares the queue, binds it to the exchange with every key and sends its events to r
+// until ctx is done. When the connection is lost it waits for the transport to reconnect
+// and consumes the queue again into r, unacked events are redelivered by the broker.
+func (t *EventsTransportImpl) Consume(ctx context.Context, opts ConsumeOptions, r chan<- *Delivery) error {
+	return t.consume(ctx, opts, false, func(d *Delivery) {
+		select {
+		case r <- d:
+		case <-ctx.Done(): // not acked, it is redelivered
+		}
+	})
+}
+
+// ConsumeFunc is Consume which calls handler for every event, the event is acked when
+// the handler returns nil. A failed event is published to the end of the queue with
+// the RepeatHeader counter, after opts.MaxRepeat repeats it is dropped or sent to the dead letter
+// exchange of the queue. The counter is not the Redelivered flag, which the broker also sets
+// for events unacked when the connection is lost.
+func (t *EventsTransportImpl) ConsumeFunc(ctx context.Context, opts ConsumeOptions, handler func(ctx context.Context, d *Delivery) error) error {
+	return t.consume(ctx, opts, false, func(d *Delivery) {
+		err := handler(ctx, d)
+		switch {
+		case err == nil:
+			err = d.Ack()
+		case d.Repeat() < opts.maxRepeat():
+			log.Printf("amqp transport: handle event %s error: %s, repeat %d", d.RoutingKey, err, d.Repeat()+1)
+			err = d.repeat(ctx)
+		default:
+			log.Printf("amqp transport: handle event %s error: %s, repeats are over", d.RoutingKey, err)
+			err = d.Nack(false)
+		}
+		if err != nil {
+			log.Printf("amqp transport: ack event %s error: %s", d.RoutingKey, err)
+		}
+	})
+}
+
+// ConsumeToKey sends bodies of the events routed with key to r, the events are acked on receive
+// and the queue is removed after it is unused for a minute
+func (t *EventsTransportImpl) ConsumeToKey(ctx context.Context, key, queName string, r chan []byte) error {
+	opts := ConsumeOptions{
+		Queue:        queName,
+		Keys:         []string{key},
+		QueueOptions: QueueOptions{Expires: time.Minute},
+	}
+	return t.consume(ctx, opts, true, func(d *Delivery) {
+		if d.Body == nil {
+			return
+		}
+		select {
+		case r <- d.Body:
+		case <-ctx.Done():
+		}
+	})
+}
+
+func newDelivery(d amqp.Delivery, ch channel, queue string) *Delivery {
+	return &Delivery{
+		Body:        d.Body,
+		RoutingKey:  d.RoutingKey,
+		Headers:     d.Headers,
+		Redelivered: d.Redelivered,
+		delivery:    d,
+		ch:          ch,
+		queue:       queue,
+	}
+}
+
+// consume subscribes to the queue and passes its deliveries to deliver, it subscribes again
+// when the consumer is lost with the connection or the channel
+func (t *EventsTransportImpl) consume(ctx context.Context, opts ConsumeOptions, autoAck bool, deliver func(d *Delivery)) error {
+	if !t.init {
+		return fmt.Errorf("amqp transport not initial!, please use NewTransportAmqpWS function for init")
+	}
+	for {
+		conn, ch, queue, msgs, err := t.subscribe(ctx, opts, autoAck)
+		if err != nil {
+			if ctx.Err() != nil || conn == nil || !conn.IsClosed() {
+				return err
+			}
+			// the connection is lost during the subscription, wait for reconnect
+		} else {
+			err = receive(ctx, msgs, func(d amqp.Delivery) {
+				deliver(newDelivery(d, ch, queue))
+			})
+			if !ch.IsClosed() {
+				_ = ch.Close()
+			}
+			if err != nil {
+				return err
+			}
+			log.Printf("amqp transport: consumer of queue %s is lost, subscribing again", opts.Queue)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.done:
+			return ErrTransportClosed
+		case <-time.After(t.options.minBackoff):
+		}
+	}
+}
+
+func (t *EventsTransportImpl) subscribe(ctx context.Context, opts ConsumeOptions, autoAck bool) (connection, channel, string, <-chan amqp.Delivery, error) {
+	conn, err := t.connection(ctx)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return conn, nil, "", nil, err
+	}
+	queue, msgs, err := t.declare(ch, opts, autoAck)
+	if err != nil {
+		if !ch.IsClosed() {
+			_ = ch.Close()
+		}
+		return conn, nil, "", nil, err
+	}
+	return conn, ch, queue, msgs, nil
+}
+
+func (t *EventsTransportImpl) declare(ch channel, opts ConsumeOptions, autoAck bool) (string, <-chan amqp.Delivery, error) {
+	if opts.Prefetch > 0 {
+		if err := ch.Qos(opts.Prefetch, 0, false); err != nil {
+			return "", nil, fmt.Errorf("set prefetch error: %w", err)
+		}
+	}
+	que, err := ch.QueueDeclare(opts.Queue, opts.Durable, opts.AutoDelete, opts.Exclusive, false, opts.args())
+	if err != nil {
+		return "", nil, fmt.Errorf("declare queue %s error: %w", opts.Queue, err)
+	}
+	for _, key := range opts.Keys {
+		if err := ch.QueueBind(que.Name, key, t.exchange, false, nil); err != nil {
+			return "", nil, fmt.Errorf("bind queue %s with key %s error: %w", que.Name, key, err)
+		}
+	}
+	msgs, err := ch.Consume(que.Name, "", autoAck, false, false, false, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("consume queue %s error: %w", que.Name, err)
+	}
+	return que.Name, msgs, nil
+}
+
+// receive passes deliveries until ctx is done or the consumer is closed
+func receive(ctx context.Context, msgs <-chan amqp.Delivery, deliver func(d amqp.Delivery)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			deliver(d)
+		}
+	}
+}
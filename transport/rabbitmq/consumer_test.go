@@ -0,0 +1,177 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeAcknowledger records the outcome of the deliveries by tag
+type fakeAcknowledger struct {
+	mu       sync.Mutex
+	outcomes map[uint64]string
+}
+
+func (a *fakeAcknowledger) set(tag uint64, outcome string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.outcomes[tag] = outcome
+	return nil
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, _ bool) error {
+	return a.set(tag, "ack")
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, _ bool, requeue bool) error {
+	if requeue {
+		return a.set(tag, "requeue")
+	}
+	return a.set(tag, "nack")
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func (a *fakeAcknowledger) outcome(tag uint64) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.outcomes[tag]
+}
+
+// consumerChannel waits for the n-th channel of conn with a consumer
+func consumerChannel(t *testing.T, conn *fakeConn, n int) *fakeChannel {
+	t.Helper()
+	var res *fakeChannel
+	waitFor(t, func() bool {
+		var consuming []*fakeChannel
+		for _, ch := range conn.opened() {
+			ch.mu.Lock()
+			if len(ch.consumers) > 0 {
+				consuming = append(consuming, ch)
+			}
+			ch.mu.Unlock()
+		}
+		if len(consuming) < n {
+			return false
+		}
+		res = consuming[n-1]
+		return true
+	})
+	return res
+}
+
+func TestTransport_Consume(t *testing.T) {
+	deliveries := make(chan amqp.Delivery)
+	conn := &fakeConn{deliveries: []chan amqp.Delivery{deliveries}}
+	tr := testTransport(t, &fakeDialer{conns: []*fakeConn{conn}})
+	ack := &fakeAcknowledger{outcomes: map[uint64]string{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := make(chan *Delivery)
+	consumed := make(chan error, 1)
+	go func() {
+		consumed <- tr.Consume(ctx, ConsumeOptions{Queue: "jobs", Keys: []string{"user.1", "user.2"}}, r)
+	}()
+	deliveries <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, RoutingKey: "user.2", Body: []byte("event")}
+	d := <-r
+	if d.RoutingKey != "user.2" || string(d.Body) != "event" {
+		t.Errorf("unexpected delivery %+v", d)
+	}
+	if err := d.Ack(); err != nil || ack.outcome(1) != "ack" {
+		t.Errorf("Ack error %v, outcome %q", err, ack.outcome(1))
+	}
+	ch := consumerChannel(t, conn, 1)
+	if bindings := ch.bindings; !reflect.DeepEqual(bindings, []string{"jobs/user.1", "jobs/user.2"}) {
+		t.Errorf("the queue must be bound with every key, bindings %v", bindings)
+	}
+
+	cancel()
+	if err := <-consumed; !errors.Is(err, context.Canceled) {
+		t.Errorf("Consume error = %v", err)
+	}
+}
+
+func TestTransport_ConsumeFunc(t *testing.T) {
+	deliveries := make(chan amqp.Delivery)
+	conn := &fakeConn{deliveries: []chan amqp.Delivery{deliveries}}
+	tr := testTransport(t, &fakeDialer{conns: []*fakeConn{conn}})
+	ack := &fakeAcknowledger{outcomes: map[uint64]string{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = tr.ConsumeFunc(ctx, ConsumeOptions{Queue: "jobs", Keys: []string{"user.1"}}, func(_ context.Context, d *Delivery) error {
+			if string(d.Body) == "bad" {
+				return errors.New("handle error")
+			}
+			return nil
+		})
+	}()
+
+	deliveries <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte("ok")}
+	waitFor(t, func() bool { return ack.outcome(1) == "ack" })
+
+	// the first failure is repeated, redelivered by the broker or not
+	deliveries <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 2, Redelivered: true,
+		Headers: amqp.Table{"trace": "t1"}, Body: []byte("bad")}
+	waitFor(t, func() bool { return ack.outcome(2) == "ack" })
+	sent := consumerChannel(t, conn, 1).sent()
+	want := []published{{"", "jobs", amqp.Table{"trace": "t1", RepeatHeader: int32(1)}, []byte("bad")}}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("the failed event must be published to the queue with the counter, published %+v", sent)
+	}
+
+	deliveries <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 3, Headers: amqp.Table{RepeatHeader: int32(1)}, Body: []byte("bad")}
+	waitFor(t, func() bool { return ack.outcome(3) == "nack" })
+	if sent := consumerChannel(t, conn, 1).sent(); len(sent) != 1 {
+		t.Errorf("the event must not be repeated after MaxRepeat, published %d", len(sent))
+	}
+}
+
+func TestTransport_ConsumeFunc_noRepeat(t *testing.T) {
+	deliveries := make(chan amqp.Delivery)
+	conn := &fakeConn{deliveries: []chan amqp.Delivery{deliveries}}
+	tr := testTransport(t, &fakeDialer{conns: []*fakeConn{conn}})
+	ack := &fakeAcknowledger{outcomes: map[uint64]string{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = tr.ConsumeFunc(ctx, ConsumeOptions{Queue: "jobs", MaxRepeat: -1}, func(context.Context, *Delivery) error {
+			return errors.New("handle error")
+		})
+	}()
+	deliveries <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte("bad")}
+	waitFor(t, func() bool { return ack.outcome(1) == "nack" })
+}
+
+func TestTransport_ConsumeResubscribe(t *testing.T) {
+	first, second := make(chan amqp.Delivery), make(chan amqp.Delivery)
+	conn := &fakeConn{deliveries: []chan amqp.Delivery{first, second}}
+	tr := testTransport(t, &fakeDialer{conns: []*fakeConn{conn}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := make(chan []byte)
+	go func() { _ = tr.ConsumeToKey(ctx, "user.1", "ws.1", r) }()
+	first <- amqp.Delivery{Body: []byte("one")}
+	if body := <-r; string(body) != "one" {
+		t.Errorf("unexpected body %s", body)
+	}
+
+	// the channel is closed by the broker, the connection is alive
+	consumerChannel(t, conn, 1).shutdown()
+	second <- amqp.Delivery{Body: []byte("two")}
+	if body := <-r; string(body) != "two" {
+		t.Errorf("unexpected body after resubscribe %s", body)
+	}
+	if bindings := consumerChannel(t, conn, 2).bindings; !reflect.DeepEqual(bindings, []string{"ws.1/user.1"}) {
+		t.Errorf("the queue must be bound again, bindings %v", bindings)
+	}
+}
@@ -0,0 +1,93 @@
+package rabbitmq
+
+import (
+	"time"
+
+	"github.com/C0nstantin/pkg/transport/rabbitmq/dial"
+)
+
+// TLSOptions configures TLS of amqps:// connections, client certificate files enable mTLS
+type TLSOptions = dial.TLSOptions
+
+// CredentialsProvider returns the user name and password for a new connection,
+// it is called on every dial, so passwords can be rotated without restart
+type CredentialsProvider = dial.CredentialsProvider
+
+// CredentialsFunc adapts a function to the CredentialsProvider interface
+type CredentialsFunc = dial.CredentialsFunc
+
+// FileCredentials reads the password from a file, like a mounted secret, on every dial
+type FileCredentials = dial.FileCredentials
+
+// NodeSelection is the order in which the nodes of a comma separated dsn are tried
+type NodeSelection = dial.NodeSelection
+
+const (
+	// NodeRoundRobin starts every new connection from the node after the previously chosen one
+	NodeRoundRobin = dial.NodeRoundRobin
+	// NodeShuffle tries the nodes in random order
+	NodeShuffle = dial.NodeShuffle
+)
+
+type dialOptions struct {
+	tls         *TLSOptions
+	credentials CredentialsProvider
+	selection   NodeSelection
+	poolSize    int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	sendTimeout time.Duration
+}
+
+// Option configures connections of NewRQTransport
+type Option func(o *dialOptions)
+
+// WithTLS sets TLS options for amqps:// dsn
+func WithTLS(options TLSOptions) Option {
+	return func(o *dialOptions) {
+		o.tls = &options
+	}
+}
+
+// WithCredentials makes the transport take the user and password from the provider on every dial
+func WithCredentials(credentials CredentialsProvider) Option {
+	return func(o *dialOptions) {
+		o.credentials = credentials
+	}
+}
+
+// WithChannelPool sets the number of idle channels Send keeps open, 8 by default
+func WithChannelPool(size int) Option {
+	return func(o *dialOptions) {
+		if size >= 0 {
+			o.poolSize = size
+		}
+	}
+}
+
+// WithReconnectBackoff sets the delay before the first reconnect attempt, it doubles after every
+// failed attempt up to max, 100ms and 30s by default
+func WithReconnectBackoff(min, max time.Duration) Option {
+	return func(o *dialOptions) {
+		if min > 0 && max >= min {
+			o.minBackoff, o.maxBackoff = min, max
+		}
+	}
+}
+
+// WithSendTimeout sets how long Send waits for a channel and the publish, including the wait
+// for a reconnect, 5s by default
+func WithSendTimeout(timeout time.Duration) Option {
+	return func(o *dialOptions) {
+		if timeout > 0 {
+			o.sendTimeout = timeout
+		}
+	}
+}
+
+// WithNodeSelection sets the order the nodes of the dsn are tried, NodeRoundRobin by default
+func WithNodeSelection(selection NodeSelection) Option {
+	return func(o *dialOptions) {
+		o.selection = selection
+	}
+}
@@ -0,0 +1,137 @@
+// Package dial connects to RabbitMQ for rmqx, queuer and transport/rabbitmq: it tries the nodes
+// of a comma separated url in order, configures TLS and takes the credentials on every dial,
+// so certificates and passwords can be rotated without restart.
+package dial
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TLSOptions configures TLS of amqps:// connections, client certificate files enable mTLS
+type TLSOptions struct {
+	CAFile     string `yaml:"ca_file" env:"RABBITMQ_TLS_CA_FILE"`
+	CertFile   string `yaml:"cert_file" env:"RABBITMQ_TLS_CERT_FILE"`
+	KeyFile    string `yaml:"key_file" env:"RABBITMQ_TLS_KEY_FILE"`
+	ServerName string `yaml:"server_name" env:"RABBITMQ_TLS_SERVER_NAME"` // empty - host of the url
+	MinVersion string `yaml:"min_version" env:"RABBITMQ_TLS_MIN_VERSION"` // "1.0" - "1.3", empty - 1.2
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Config returns the tls config, files are read on every call so rotated certificates are used by new connections
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: o.ServerName, MinVersion: tls.VersionTLS12}
+	if o.MinVersion != "" {
+		v, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", o.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file error: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", o.CAFile)
+		}
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate error: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// CredentialsProvider returns the user name and password for a new connection,
+// it is called on every dial, so passwords can be rotated without restart
+type CredentialsProvider interface {
+	Credentials() (username, password string, err error)
+}
+
+// CredentialsFunc adapts a function to the CredentialsProvider interface
+type CredentialsFunc func() (username, password string, err error)
+
+func (f CredentialsFunc) Credentials() (string, string, error) {
+	return f()
+}
+
+// FileCredentials reads the password from a file, like a mounted secret, on every dial
+type FileCredentials struct {
+	Username     string
+	PasswordFile string
+}
+
+// NewFileCredentials returns FileCredentials with the user of the first url of the comma separated list
+func NewFileCredentials(connectionUrl, passwordFile string) FileCredentials {
+	var username string
+	if urls := SplitURLs(connectionUrl); len(urls) > 0 {
+		if u, err := url.Parse(urls[0]); err == nil {
+			username = u.User.Username()
+		}
+	}
+	return FileCredentials{Username: username, PasswordFile: passwordFile}
+}
+
+func (f FileCredentials) Credentials() (string, string, error) {
+	password, err := os.ReadFile(f.PasswordFile)
+	if err != nil {
+		return "", "", fmt.Errorf("read password file error: %w", err)
+	}
+	return f.Username, strings.TrimSpace(string(password)), nil
+}
+
+// Connect connects to one node, TLS options are used for amqps:// urls, nil options - the defaults of amqp091,
+// nil credentials - the user and password of the url
+func Connect(connectionUrl string, tlsOptions *TLSOptions, credentials CredentialsProvider) (*amqp.Connection, error) {
+	cfg := amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+	}
+	if strings.HasPrefix(connectionUrl, "amqps://") && tlsOptions != nil {
+		tlsConfig, err := tlsOptions.Config()
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLSClientConfig = tlsConfig
+	}
+	if credentials != nil {
+		username, password, err := credentials.Credentials()
+		if err != nil {
+			return nil, err
+		}
+		cfg.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: username, Password: password}}
+	}
+	conn, err := amqp.DialConfig(connectionUrl, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s return error: %w", RedactURL(connectionUrl), err)
+	}
+	return conn, nil
+}
+
+// RedactURL hides the password of the url for logs and error messages
+func RedactURL(connectionUrl string) string {
+	u, err := url.Parse(connectionUrl)
+	if err != nil {
+		return "invalid url"
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,5 @@
+module github.com/C0nstantin/pkg/transport/rabbitmq/dial
+
+go 1.19
+
+require github.com/rabbitmq/amqp091-go v1.9.0
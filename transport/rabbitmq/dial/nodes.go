@@ -0,0 +1,145 @@
+package dial
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// NodeSelection is the order in which the nodes of a comma separated url are tried
+type NodeSelection string
+
+const (
+	// NodeRoundRobin starts every new connection from the node after the previously chosen one
+	NodeRoundRobin NodeSelection = "round-robin"
+	// NodeShuffle tries the nodes in random order
+	NodeShuffle NodeSelection = "shuffle"
+)
+
+// Nodes keeps the selection state of a node list and the node of the last connection
+type Nodes struct {
+	mu      sync.Mutex
+	urls    []string
+	next    int
+	current string
+}
+
+var shared sync.Map
+
+// NewNodes returns the nodes of a comma separated url
+func NewNodes(connectionUrl string) *Nodes {
+	return &Nodes{urls: SplitURLs(connectionUrl)}
+}
+
+// SharedNodes returns the nodes of the url shared by all callers with the same list,
+// so configs of one cluster continue the round robin of each other
+func SharedNodes(connectionUrl string) *Nodes {
+	if nodes, ok := shared.Load(connectionUrl); ok {
+		return nodes.(*Nodes)
+	}
+	nodes, _ := shared.LoadOrStore(connectionUrl, NewNodes(connectionUrl))
+	return nodes.(*Nodes)
+}
+
+// SplitURLs returns the urls of a comma separated list
+func SplitURLs(connectionUrl string) []string {
+	var urls []string
+	for _, u := range strings.Split(connectionUrl, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// Len returns the number of the nodes
+func (n *Nodes) Len() int {
+	return len(n.urls)
+}
+
+// Order returns the urls in the order they are tried by the next Connect
+func (n *Nodes) Order(selection NodeSelection) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	urls := make([]string, 0, len(n.urls))
+	if selection == NodeShuffle {
+		for _, i := range rand.Perm(len(n.urls)) {
+			urls = append(urls, n.urls[i])
+		}
+		return urls
+	}
+	if len(n.urls) == 0 {
+		return urls
+	}
+	start := n.next % len(n.urls)
+	n.next = start + 1
+	urls = append(urls, n.urls[start:]...)
+	return append(urls, n.urls[:start]...)
+}
+
+// Connect connects to the first available node in selection order and returns its url
+func (n *Nodes) Connect(selection NodeSelection, tlsOptions *TLSOptions, credentials CredentialsProvider) (*amqp.Connection, string, error) {
+	urls := n.Order(selection)
+	if len(urls) == 0 {
+		return nil, "", fmt.Errorf("connection url must be not empty")
+	}
+	var failures NodeErrors
+	for _, u := range urls {
+		conn, err := Connect(u, tlsOptions, credentials)
+		if err == nil {
+			n.connected(u, conn)
+			return conn, u, nil
+		}
+		if len(urls) == 1 {
+			return nil, "", err
+		}
+		failures = append(failures, err)
+	}
+	return nil, "", failures
+}
+
+// NodeErrors is the error of Connect when every node is unavailable, errors.Is and errors.As
+// match the error of any node, so connection errors can be classified as with one node
+type NodeErrors []error
+
+func (e NodeErrors) Error() string {
+	failures := make([]string, len(e))
+	for i, err := range e {
+		failures[i] = err.Error()
+	}
+	return fmt.Sprintf("all %d nodes are unavailable: %s", len(e), strings.Join(failures, "; "))
+}
+
+func (e NodeErrors) Unwrap() []error {
+	return e
+}
+
+// connected remembers the node of the connection until the connection is lost
+func (n *Nodes) connected(url string, conn *amqp.Connection) {
+	n.mu.Lock()
+	n.current = url
+	n.mu.Unlock()
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		<-closed
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if n.current == url {
+			n.current = ""
+		}
+	}()
+}
+
+// ConnectedNode returns the url, without the password, of the node of the last connection,
+// it is empty when that connection is closed
+func (n *Nodes) ConnectedNode() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.current == "" {
+		return ""
+	}
+	return RedactURL(n.current)
+}
@@ -2,4 +2,7 @@ module github.com/C0nstantin/pkg/transport/rabbitmq
 
 go 1.19
 
-require github.com/rabbitmq/amqp091-go v1.9.0
+require (
+	github.com/C0nstantin/pkg/transport/rabbitmq/dial v0.1.0
+	github.com/rabbitmq/amqp091-go v1.9.0
+)
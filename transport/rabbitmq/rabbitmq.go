@@ -2,126 +2,315 @@ package rabbitmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
 	"time"
 
+	"github.com/C0nstantin/pkg/transport/rabbitmq/dial"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// ErrTransportClosed is returned by the methods of a closed transport
+var ErrTransportClosed = errors.New("amqp transport is closed")
+
 type Sender interface {
 	Send(key string, env []byte) error
-	Close()
+	Close() error
 }
 
 type Consumer interface {
 	ConsumeToKey(ctx context.Context, key, queName string, r chan []byte) error
 }
 
+// connection is the part of *amqp.Connection used by the transport
+type connection interface {
+	Channel() (channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	IsClosed() bool
+	Close() error
+}
+
+// channel is the part of *amqp.Channel used by the transport
+type channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	IsClosed() bool
+	Close() error
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c amqpConnection) Channel() (channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// EventsTransportImpl publishes events through a pool of channels. When the connection is lost
+// it reconnects in background with exponential backoff and declares the exchange again,
+// Send waits for the new connection until its timeout.
 type EventsTransportImpl struct {
 	init     bool
-	con      *amqp.Connection
-	dsn      string
+	mu       sync.Mutex
+	con      connection
+	node     string
+	ready    chan struct{} // closed while con is connected
+	dial     func() (connection, string, error)
 	exchange string
+	kind     string
+	options  *dialOptions
+	channels chan channel
+	done     chan struct{}
+	close    sync.Once
 }
 
-func (t *EventsTransportImpl) Send(key string, event []byte) error {
-	if !t.init {
-		return fmt.Errorf("amqp transport not initial !, please use NewTransportAmqpWS function for init")
+// connect dials the next available node, declares the exchange and starts watching the connection
+func (t *EventsTransportImpl) connect() error {
+	conn, node, err := t.dial()
+	if err != nil {
+		return err
 	}
-	if t.con.IsClosed() {
-		return fmt.Errorf("connection is closed! ")
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return err
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	ch, err := t.con.Channel()
+	err = ch.ExchangeDeclare(t.exchange, t.kind, true, false, false, false, nil)
 	if err != nil {
+		_ = conn.Close()
 		return err
 	}
-	defer ch.Close()
-	// logs.Infof("try send events to exchange %s, key %s, events %s", t.exchange, key, event)
+	_ = ch.Close()
 
-	return ch.PublishWithContext(ctx, t.exchange, key, false, false, amqp.Publishing{
-		ContentType:  "application/json",
-		DeliveryMode: 0,
-		Priority:     0,
-		Body:         event,
-	})
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	t.mu.Lock()
+	select {
+	case <-t.done: // closed while connecting
+		t.mu.Unlock()
+		_ = conn.Close()
+		return ErrTransportClosed
+	default:
+	}
+	t.con, t.node = conn, node
+	close(t.ready)
+	t.mu.Unlock()
+	go t.watch(closed)
+	return nil
+}
+
+// watch reconnects when the connection is lost, until the transport is closed
+func (t *EventsTransportImpl) watch(closed chan *amqp.Error) {
+	select {
+	case <-t.done:
+		return
+	case err := <-closed:
+		if err == nil { // closed by Close
+			return
+		}
+		t.mu.Lock()
+		t.disconnected()
+		node := t.node
+		t.mu.Unlock()
+		log.Printf("amqp transport: connection to %s lost: %s", dial.RedactURL(node), err)
+	}
+
+	backoff := t.options.minBackoff
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-time.After(backoff):
+		}
+		err := t.connect()
+		if err == nil {
+			log.Printf("amqp transport: reconnected to %s", t.ConnectedNode())
+			return
+		}
+		log.Printf("amqp transport: reconnect error: %s, next attempt in %s", err, backoff)
+		if backoff *= 2; backoff > t.options.maxBackoff {
+			backoff = t.options.maxBackoff
+		}
+	}
+}
+
+// connection waits until the transport is connected
+func (t *EventsTransportImpl) connection(ctx context.Context) (connection, error) {
+	for {
+		select {
+		case <-t.done: // checked first, ready is still closed after Close
+			return nil, ErrTransportClosed
+		default:
+		}
+		t.mu.Lock()
+		ready := t.ready
+		t.mu.Unlock()
+		select {
+		case <-t.done:
+			return nil, ErrTransportClosed
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connection is closed, wait for reconnect: %w", ctx.Err())
+		case <-ready:
+		}
+		t.mu.Lock()
+		conn := t.con
+		if !conn.IsClosed() {
+			t.mu.Unlock()
+			return conn, nil
+		}
+		t.disconnected() // lost, but watch has not received the notification yet
+		t.mu.Unlock()
+	}
+}
+
+// disconnected makes callers of connection wait for the reconnect, t.mu must be held
+func (t *EventsTransportImpl) disconnected() {
+	select {
+	case <-t.ready:
+		t.ready = make(chan struct{})
+	default: // already waiting
+	}
 }
-func (t *EventsTransportImpl) Close() {
-	if !t.con.IsClosed() {
-		err := t.con.Close()
+
+// channel takes an open channel from the pool or opens a new one
+func (t *EventsTransportImpl) channel(ctx context.Context) (channel, error) {
+	for {
+		select {
+		case ch := <-t.channels:
+			if ch.IsClosed() { // channel of the lost connection or closed by an error
+				continue
+			}
+			return ch, nil
+		default:
+		}
+		conn, err := t.connection(ctx)
 		if err != nil {
-			panic("error close connection" + err.Error())
+			return nil, err
 		}
+		return conn.Channel()
 	}
 }
-func (t *EventsTransportImpl) ConsumeToKey(ctx context.Context, key, queName string, r chan []byte) error {
-	if !t.init {
-		return fmt.Errorf("amqp transport not initial!, please use NewTransportAmqpWS function for init")
+
+// release returns the channel to the pool, it is closed when the pool is full
+func (t *EventsTransportImpl) release(ch channel) {
+	if ch.IsClosed() {
+		return
 	}
-	if t.con.IsClosed() {
-		return fmt.Errorf("connection is closed! ")
+	select {
+	case t.channels <- ch:
+	default:
+		_ = ch.Close()
 	}
-	ch, err := t.con.Channel()
-	if err != nil {
-		return err
+}
+
+// ConnectedNode returns the url, without the password, of the node the transport is connected to
+func (t *EventsTransportImpl) ConnectedNode() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.con == nil || t.con.IsClosed() {
+		return ""
 	}
-	defer ch.Close()
+	return dial.RedactURL(t.node)
+}
 
-	que, err := ch.QueueDeclare(queName, false, false, false, false, amqp.Table{"x-expires": 60000})
-	if err != nil {
-		return err
+func (t *EventsTransportImpl) Send(key string, event []byte) error {
+	if !t.init {
+		return fmt.Errorf("amqp transport not initial !, please use NewTransportAmqpWS function for init")
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.options.sendTimeout)
+	defer cancel()
 
-	err = ch.QueueBind(que.Name, key, t.exchange, false, nil)
+	ch, err := t.channel(ctx)
 	if err != nil {
 		return err
 	}
-	msgs, err := ch.Consume(
-		que.Name,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
+	defer t.release(ch)
+	// logs.Infof("try send events to exchange %s, key %s, events %s", t.exchange, key, event)
+
+	return ch.PublishWithContext(ctx, t.exchange, key, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: 0,
+		Priority:     0,
+		Body:         event,
+	})
+}
+
+// Close stops reconnecting and closes the channels and the connection
+func (t *EventsTransportImpl) Close() error {
+	if !t.init {
+		return nil
 	}
-	for {
-		select {
-		case d := <-msgs:
-			if d.Body != nil {
-				r <- d.Body
+	var err error
+	t.close.Do(func() {
+		close(t.done)
+	drain:
+		for {
+			select {
+			case ch := <-t.channels:
+				if !ch.IsClosed() {
+					_ = ch.Close()
+				}
+			default:
+				break drain
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.con.IsClosed() {
+			if e := t.con.Close(); e != nil {
+				err = fmt.Errorf("close connection error: %w", e)
+			}
+		}
+	})
+	return err
 }
 
-func NewRQTransport(dsn, exchange, kind string) (*EventsTransportImpl, error) {
-	conn, err := amqp.Dial(dsn)
-	if err != nil {
-		return nil, err
+// NewRQTransport connects to the broker and declares the exchange, options set TLS, credentials,
+// the channel pool size, the reconnect backoff and the send timeout.
+// dsn may list several comma separated nodes, a lost connection is replaced by a connection to the next available one
+func NewRQTransport(dsn, exchange, kind string, opts ...Option) (*EventsTransportImpl, error) {
+	options := &dialOptions{
+		poolSize:    8,
+		minBackoff:  100 * time.Millisecond,
+		maxBackoff:  30 * time.Second,
+		sendTimeout: 5 * time.Second,
 	}
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, err
+	for _, opt := range opts {
+		opt(options)
 	}
-	defer ch.Close()
-
-	err = ch.ExchangeDeclare(exchange, kind, true, false, false, false, nil)
+	nodes := dial.NewNodes(dsn)
+	return newTransport(func() (connection, string, error) {
+		conn, node, err := nodes.Connect(options.selection, options.tls, options.credentials)
+		if err != nil {
+			return nil, "", err
+		}
+		return amqpConnection{conn}, node, nil
+	}, exchange, kind, options)
+}
 
-	if err != nil {
-		return nil, err
-	}
-	return &EventsTransportImpl{
+// newTransport connects with dial and declares the exchange
+func newTransport(dial func() (connection, string, error), exchange, kind string, options *dialOptions) (*EventsTransportImpl, error) {
+	t := &EventsTransportImpl{
 		init:     true,
-		con:      conn,
+		ready:    make(chan struct{}),
 		exchange: exchange,
-		dsn:      dsn,
-	}, nil
+		kind:     kind,
+		dial:     dial,
+		options:  options,
+		channels: make(chan channel, options.poolSize),
+		done:     make(chan struct{}),
+	}
+	if err := t.connect(); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
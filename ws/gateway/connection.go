@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSlowClient closes a connection whose send buffer is full
+	ErrSlowClient = errors.New("client is too slow")
+	errGoingAway  = errors.New("gateway is closed")
+)
+
+// stream is the protocol of a connection, the writes and pings are called by one goroutine
+type stream interface {
+	// read blocks until the client is gone or the stream is closed
+	read() error
+	write(event []byte) error
+	ping() error
+	// close tells the client why the connection is closed, unless the client has closed it, and stops read
+	close(reason error, byClient bool)
+}
+
+// connection forwards events to one client, a writer goroutine writes the send buffer
+// and pings, a reader goroutine detects the gone client
+type connection struct {
+	id      string
+	stream  stream
+	options Options
+	send    chan []byte
+	replay  *replay // nil without a history
+}
+
+func newConnection(id string, s stream, opts Options) *connection {
+	return &connection{
+		id:      id,
+		stream:  s,
+		options: opts,
+		send:    make(chan []byte, opts.SendBuffer),
+	}
+}
+
+// deliver adds the event to the send buffer, it returns false when the buffer is full
+func (c *connection) deliver(event []byte) bool {
+	select {
+	case c.send <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// resume sends the events the client missed before the live events
+func (c *connection) resume(ctx context.Context) error {
+	if c.replay == nil {
+		return nil
+	}
+	missed, err := c.replay.resume(ctx)
+	if err != nil {
+		return err
+	}
+	return c.wait(missed)
+}
+
+// forward sends the live event, with a history the missed events preceding it are sent first
+func (c *connection) forward(ctx context.Context, event []byte) error {
+	if c.replay != nil {
+		missed, live, err := c.replay.live(ctx, event)
+		if err != nil {
+			return err
+		}
+		if err := c.wait(missed); err != nil {
+			return err
+		}
+		if event = live; event == nil {
+			return nil
+		}
+	}
+	if !c.deliver(event) {
+		return ErrSlowClient
+	}
+	return nil
+}
+
+// wait adds the events to the send buffer, waiting for the writer up to WriteTimeout for every event,
+// a history may hold more events than the buffer
+func (c *connection) wait(events [][]byte) error {
+	for _, event := range events {
+		select {
+		case c.send <- event:
+		case <-time.After(c.options.WriteTimeout):
+			return ErrSlowClient
+		}
+	}
+	return nil
+}
+
+// serve runs subscribe and forwards its events until the client disconnects, it lags behind
+// or done is closed, the returned error is the reason to close the connection
+func (c *connection) serve(subscribe func(ctx context.Context, id string, events chan []byte) error, done <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	events := make(chan []byte)
+	subscribed := make(chan error, 1)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		subscribed <- subscribe(ctx, c.id, events)
+	}()
+	lost := make(chan error, 2)
+	go func() {
+		defer wg.Done()
+		lost <- c.stream.read()
+	}()
+	go func() {
+		defer wg.Done()
+		lost <- c.write(ctx)
+	}()
+
+	err := c.resume(ctx)
+	byClient := false
+loop:
+	for err == nil {
+		select {
+		case event := <-events:
+			err = c.forward(ctx, event)
+		case err = <-subscribed:
+			if err == nil {
+				err = errors.New("subscription is closed")
+			}
+			break loop
+		case err = <-lost:
+			byClient = true
+			break loop
+		case <-done:
+			err = errGoingAway
+			break loop
+		}
+	}
+	cancel()
+	c.stream.close(err, byClient)
+	wg.Wait()
+	return err
+}
+
+// write writes the send buffer and pings the client until ctx is done
+func (c *connection) write(ctx context.Context) error {
+	ticker := time.NewTicker(c.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-c.send:
+			if err := c.stream.write(event); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := c.stream.ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package gateway delivers events published by ws.Pusher to WebSocket clients,
+// its Controller implements serve.Controller and can be mounted on serve.HTTPServe.
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/C0nstantin/pkg/serve"
+	"github.com/C0nstantin/pkg/transport/rabbitmq"
+	"github.com/C0nstantin/pkg/ws"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// ErrNoKeys is returned when a connection request has no subscription keys
+var ErrNoKeys = errors.New("connection has no subscription keys")
+
+// ErrPresenceKey is returned when a connection requests the key of presence messages
+var ErrPresenceKey = errors.New("presence key can not be subscribed to")
+
+// Keys returns the subscription keys of a connection request
+type Keys func(ctx *gin.Context) ([]string, error)
+
+// QueryKeys takes the keys from the key query parameters, ?key=user1&key=group1
+func QueryKeys(ctx *gin.Context) ([]string, error) {
+	keys := ctx.QueryArray("key")
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return keys, nil
+}
+
+// Options configures the connections of the Controller
+type Options struct {
+	// QueuePrefix is the prefix of the queues of connections, a connection consumes
+	// a queue named prefix.connection id.key for every key
+	QueuePrefix string
+	// PingInterval is the interval of pings, a client which does not answer with a pong
+	// for PongTimeout is disconnected
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// WriteTimeout limits writing of one message
+	WriteTimeout time.Duration
+	// SendBuffer is the number of events waiting to be written to a client,
+	// a client which lags behind more is disconnected
+	SendBuffer int
+	// CheckOrigin is websocket.Upgrader.CheckOrigin, nil allows only same origin requests
+	CheckOrigin func(r *http.Request) bool
+}
+
+func (o *Options) defaults() {
+	if o.QueuePrefix == "" {
+		o.QueuePrefix = "ws"
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = 30 * time.Second
+	}
+	if o.PongTimeout <= 0 {
+		o.PongTimeout = 2 * o.PingInterval
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = 10 * time.Second
+	}
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = 64
+	}
+}
+
+// Controller serves:
+//
+//	GET /path?key=K1&key=K2    upgrades the request to a WebSocket connection
+//
+// The connection receives every event pushed with one of its keys as a text message,
+// the JSON of ws.PusherImpl is passed as is. Messages of the client are ignored.
+// Errors of the keys are passed to ctx.Error, so serve.DefaultErrorHandler renders them,
+// a request without keys fails with a bind error.
+type Controller struct {
+	serve.BaseController
+	// Auth and Middlewares protect the route, see serve.Protect
+	Auth        serve.Auth
+	Middlewares []gin.HandlerFunc
+	// Keys returns the subscription keys of a connection, QueryKeys by default, JWTKeys with EnableJWT
+	Keys Keys
+
+	consumer rabbitmq.Consumer
+	options  Options
+	upgrader websocket.Upgrader
+	history  ws.History
+	presence *Presence
+	done     chan struct{}
+	close    sync.Once
+}
+
+// NewController creates a controller subscribing connections via consumer,
+// rabbitmq.EventsTransportImpl of the exchange of the ws.Pusher implements it
+func NewController(consumer rabbitmq.Consumer, opts Options) *Controller {
+	opts.defaults()
+	return &Controller{
+		Keys:     QueryKeys,
+		consumer: consumer,
+		options:  opts,
+		upgrader: websocket.Upgrader{CheckOrigin: opts.CheckOrigin},
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *Controller) InitRoute(routes gin.IRoutes, path string) {
+	c.GET(serve.Protect(routes, c.Auth, c.Middlewares...), path, c.connect)
+}
+
+// EnableReplay sends a reconnecting client the events it missed from history before the live events,
+// the ws.PusherImpl must push events with the same history. The client passes the ids of the last
+// received events of its keys, the Key and the Id of the events, in since query parameters,
+// ?key=user1&since=user1:17
+func (c *Controller) EnableReplay(history ws.History) {
+	c.history = history
+}
+
+// Close disconnects every client, the server shutdown does not wait for hijacked connections
+func (c *Controller) Close() {
+	c.close.Do(func() { close(c.done) })
+}
+
+// connect upgrades the request and serves the connection until it is closed,
+// errors after the upgrade are logged because the response is already written
+func (c *Controller) connect(ctx *gin.Context) error {
+	keys, err := requestKeys(ctx, c.Keys, c.presence, c.done)
+	if err != nil {
+		return err
+	}
+	since := resumePositions(ctx, keys, "")
+	wsConn, err := c.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		return nil // the upgrader responded with the error
+	}
+	conn := newConnection(newID(), &wsStream{ws: wsConn, options: c.options}, c.options)
+	if c.presence != nil {
+		c.presence.connect(conn.id, keys)
+		defer c.presence.disconnect(conn.id)
+	}
+	if c.history != nil {
+		conn.replay = newReplay(c.history, since)
+	}
+	if err := conn.serve(subscribe(c.consumer, c.options.QueuePrefix, keys), c.done); err != nil {
+		log.Printf("ws gateway: connection %s of %v closed: %s", conn.id, keys, err)
+	}
+	return nil
+}
+
+// requestKeys returns the keys of a new connection, a request without keys fails with a bind error
+func requestKeys(ctx *gin.Context, f Keys, presence *Presence, done <-chan struct{}) ([]string, error) {
+	select {
+	case <-done:
+		return nil, errGoingAway
+	default:
+	}
+	keys, err := f(ctx)
+	if err == nil && len(keys) == 0 {
+		err = ErrNoKeys
+	}
+	if err == nil && presence != nil && contains(keys, presence.options.Key) {
+		err = ErrPresenceKey
+	}
+	if errors.Is(err, ErrNoKeys) || errors.Is(err, ErrPresenceKey) {
+		return nil, bindError(err)
+	}
+	return keys, err
+}
+
+// subscribe returns a function consuming every key into a queue of the connection until its context is done
+func subscribe(consumer rabbitmq.Consumer, prefix string, keys []string) func(ctx context.Context, id string, events chan []byte) error {
+	return func(ctx context.Context, id string, events chan []byte) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		errs := make(chan error, len(keys))
+		for _, key := range keys {
+			go func(key string) {
+				queue := fmt.Sprintf("%s.%s.%s", prefix, id, key)
+				if err := consumer.ConsumeToKey(ctx, key, queue, events); err != nil && ctx.Err() == nil {
+					errs <- fmt.Errorf("consume key %s error: %w", key, err)
+					return
+				}
+				errs <- nil
+			}(key)
+		}
+		var res error
+		for range keys {
+			// the first failed key stops the others
+			if err := <-errs; err != nil && res == nil {
+				res = err
+				cancel()
+			}
+		}
+		return res
+	}
+}
+
+func bindError(err error) error {
+	return &gin.Error{Err: err, Type: gin.ErrorTypeBind}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
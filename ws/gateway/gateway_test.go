@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type fakeConsumer struct {
+	mu     sync.Mutex
+	queues map[string]string
+	events map[string]chan []byte
+	// consumers is the number of consumers of every queue
+	consumers map[string]int
+	ready     chan struct{}
+}
+
+func newFakeConsumer(keys int) *fakeConsumer {
+	return &fakeConsumer{
+		queues:    map[string]string{},
+		events:    map[string]chan []byte{},
+		consumers: map[string]int{},
+		ready:     make(chan struct{}, keys),
+	}
+}
+
+func (f *fakeConsumer) ConsumeToKey(ctx context.Context, key, queName string, r chan []byte) error {
+	f.mu.Lock()
+	f.queues[key] = queName
+	f.events[key] = r
+	f.consumers[queName]++
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.consumers[queName]--
+		f.mu.Unlock()
+	}()
+	f.ready <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (f *fakeConsumer) queueConsumers(queue string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.consumers[queue]
+}
+
+func (f *fakeConsumer) push(key, event string) {
+	f.mu.Lock()
+	r := f.events[key]
+	f.mu.Unlock()
+	r <- []byte(event)
+}
+
+func TestController(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	consumer := newFakeConsumer(2)
+	c := NewController(consumer, Options{QueuePrefix: "test"})
+	r := gin.New()
+	c.InitRoute(r, "/ws")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?key=user1&key=group1"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-consumer.ready:
+		case <-time.After(time.Second):
+			t.Fatal("connection is not subscribed")
+		}
+	}
+	if q := consumer.queues["group1"]; !strings.HasPrefix(q, "test.") || !strings.HasSuffix(q, ".group1") {
+		t.Errorf("unexpected queue %s", q)
+	}
+
+	consumer.push("group1", `{"Type":"message"}`)
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	_, msg, err := ws.ReadMessage()
+	if err != nil || string(msg) != `{"Type":"message"}` {
+		t.Fatalf("unexpected message %s, %v", msg, err)
+	}
+
+	c.Close()
+	_, _, err = ws.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected going away close, got %v", err)
+	}
+}
+
+func TestConnection_deliver(t *testing.T) {
+	c := newConnection(newID(), nil, Options{SendBuffer: 1})
+	if !c.deliver([]byte("1")) {
+		t.Error("first event must be buffered")
+	}
+	if c.deliver([]byte("2")) {
+		t.Error("event must be refused when the buffer is full")
+	}
+}
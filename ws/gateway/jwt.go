@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/C0nstantin/pkg/auth/jwt"
+	"github.com/C0nstantin/pkg/serve"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrForbiddenKey is returned when a client requests a key it can not receive,
+	// add it to ForbiddenErrors of serve.DefaultErrorHandler
+	ErrForbiddenKey = errors.New("subscription to the key is forbidden")
+	ErrInvalidClaim = errors.New("invalid subscription claim in jwt body")
+)
+
+// JWTKeys derives the subscription keys from the jwt.JWTBody of a request authenticated
+// by the auth/jwt middleware, so a user receives only events pushed to the user or to its groups.
+//
+// The user key is UserPrefix + JWTBody.Id. Claims maps names of JWTBody.Info claims to the prefixes
+// of their keys, a claim is a string, a number or a list of them, e.g. with {"groups": "group."}
+// the claim "groups": ["admins", "sales"] gives the keys group.admins and group.sales.
+// Missing claims give no keys.
+//
+// A client may narrow the subscription with key query parameters, every requested key must be
+// one of the derived keys, otherwise the request fails with ErrForbiddenKey.
+type JWTKeys struct {
+	UserPrefix string
+	Claims     map[string]string
+}
+
+// EnableJWT protects the route with auth, the auth/jwt Auth, and subscribes connections
+// to the keys derived from their tokens. Browsers can not set headers of WebSocket requests,
+// so the token is passed in the token query parameter or the jwt cookie.
+func (c *Controller) EnableJWT(auth serve.Auth, keys JWTKeys) {
+	c.Auth = auth
+	c.Keys = keys.Keys
+}
+
+// Keys implements Keys
+func (k JWTKeys) Keys(ctx *gin.Context) ([]string, error) {
+	body, err := jwt.BodyFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if body.Id == "" {
+		return nil, jwt.ErrInvalidID
+	}
+	allowed := []string{k.UserPrefix + body.Id}
+	for claim, prefix := range k.Claims {
+		values, err := claimValues(body.Info[claim])
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %s", ErrInvalidClaim, claim, err)
+		}
+		for _, v := range values {
+			allowed = append(allowed, prefix+v)
+		}
+	}
+
+	requested := ctx.QueryArray("key")
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	for _, key := range requested {
+		if !contains(allowed, key) {
+			return nil, fmt.Errorf("%w %s", ErrForbiddenKey, key)
+		}
+	}
+	return requested, nil
+}
+
+// claimValues converts a claim decoded from JSON to keys
+func claimValues(claim interface{}) ([]string, error) {
+	switch v := claim.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			values, err := claimValues(item)
+			if err != nil {
+				return nil, err
+			}
+			if len(values) != 1 {
+				return nil, fmt.Errorf("unsupported list item %v", item)
+			}
+			res = append(res, values[0])
+		}
+		return res, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []string{v}, nil
+	case float64, bool:
+		return []string{fmt.Sprint(v)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", claim)
+	}
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/C0nstantin/pkg/auth/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+func TestJWTKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := jwt.NewMustJwtAuthService([]byte(strings.Repeat("secret", 30)))
+	token, _, err := auth.Jwt.TokenGenerator(&jwt.JWTBody{
+		Id:    "42",
+		Email: "user@example.com",
+		Info:  map[string]interface{}{"groups": []interface{}{"admins", "sales"}, "org": 7},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtKeys := JWTKeys{UserPrefix: "user.", Claims: map[string]string{"groups": "group.", "org": "org.", "teams": "team."}}
+
+	var keys []string
+	r := gin.New()
+	r.GET("/ws", auth.AuthMiddleware(), func(ctx *gin.Context) {
+		keys, err = jwtKeys.Keys(ctx)
+	})
+	get := func(query string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ws?token="+token+query, nil))
+		return w.Code
+	}
+
+	if code := get(""); code != http.StatusOK || err != nil {
+		t.Fatalf("unexpected response %d, %v", code, err)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "group.admins,group.sales,org.7,user.42" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	get("&key=group.sales")
+	if err != nil || len(keys) != 1 || keys[0] != "group.sales" {
+		t.Errorf("unexpected requested keys %v, %v", keys, err)
+	}
+	get("&key=user.42&key=user.43")
+	if !errors.Is(err, ErrForbiddenKey) {
+		t.Errorf("expected forbidden key, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Accept", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("request without token must be unauthorized, got %d", w.Code)
+	}
+}
+
+func TestClaimValues(t *testing.T) {
+	if _, err := claimValues(map[string]interface{}{"a": "b"}); err == nil {
+		t.Error("expected error of an object claim")
+	}
+	if _, err := claimValues([]interface{}{"a", []interface{}{"b", "c"}}); err == nil {
+		t.Error("expected error of a nested list")
+	}
+}
@@ -0,0 +1,353 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/C0nstantin/pkg/serve"
+	"github.com/C0nstantin/pkg/transport/rabbitmq"
+	"github.com/C0nstantin/pkg/ws"
+	"github.com/gin-gonic/gin"
+)
+
+// Types of the events pushed when a key comes online and goes offline
+const (
+	PresenceJoin  = "presence.join"
+	PresenceLeave = "presence.leave"
+)
+
+// PresenceOptions configures presence tracking
+type PresenceOptions struct {
+	// Key is the routing key of presence messages of the replicas, ws.presence by default.
+	// Controllers tracked by the presence reject connections requesting it with ErrPresenceKey,
+	// still prefer an exchange clients can not subscribe to, the key pattern of a topic exchange
+	// may match it
+	Key string
+	// QueuePrefix is the prefix of the queues of the replicas, prefix.replica id
+	QueuePrefix string
+	// HeartbeatInterval is the interval of the heartbeats of a replica, connections of a replica
+	// which sends no heartbeat for TTL are offline
+	HeartbeatInterval time.Duration
+	TTL               time.Duration
+	// Sender is the sender of join and leave events
+	Sender string
+	// Recipients returns the keys receiving join and leave events of the key, nil - the events are not pushed
+	Recipients func(key string) []string
+}
+
+func (o *PresenceOptions) defaults() {
+	if o.Key == "" {
+		o.Key = "ws.presence"
+	}
+	if o.QueuePrefix == "" {
+		o.QueuePrefix = o.Key
+	}
+	if o.HeartbeatInterval <= 0 {
+		o.HeartbeatInterval = 10 * time.Second
+	}
+	if o.TTL <= 0 {
+		o.TTL = 3 * o.HeartbeatInterval
+	}
+	if o.Sender == "" {
+		o.Sender = "presence"
+	}
+}
+
+type presenceConn struct {
+	Conn string
+	Keys []string
+}
+
+// presenceMessage is sent by a replica when its clients connect and disconnect,
+// the heartbeat lists every connection of the replica
+type presenceMessage struct {
+	Replica     string
+	Type        string // connect, disconnect or heartbeat
+	Connections []presenceConn
+}
+
+// Presence tracks which keys have connections to the gateway replicas. Every replica
+// sends the connections and the disconnections of its clients and heartbeats to the replicas
+// via RabbitMQ and keeps the connections of all replicas until they expire, so any replica
+// answers who is online. A started replica knows the connections of the others after their heartbeats.
+//
+// When a key comes online PresenceJoin is pushed by the replica of the connection,
+// when it goes offline PresenceLeave is pushed by the replica of the last connection,
+// or, for expired connections of a gone replica, by the live replica with the least id.
+// The body of the events is {"Key": key}.
+//
+// Presence implements serve.Controller, Auth and Middlewares protect the route like those of Controller:
+//
+//	GET /path?key=K1&key=K2    {"K1": true, "K2": false}
+type Presence struct {
+	serve.BaseController
+	Auth        serve.Auth
+	Middlewares []gin.HandlerFunc
+
+	id       string
+	sender   rabbitmq.Sender
+	consumer rabbitmq.Consumer
+	pusher   ws.Pusher
+	options  PresenceOptions
+
+	mu       sync.Mutex
+	local    map[string][]string             // keys of connections of the replica
+	online   map[string]map[string]time.Time // key - replica/connection - expiration
+	replicas map[string]time.Time            // replica - last heartbeat
+}
+
+// NewPresence creates presence tracking of the replica, sender and consumer are the transport
+// of presence messages, pusher pushes join and leave events
+func NewPresence(sender rabbitmq.Sender, consumer rabbitmq.Consumer, pusher ws.Pusher, opts PresenceOptions) *Presence {
+	opts.defaults()
+	return &Presence{
+		id:       newID(),
+		sender:   sender,
+		consumer: consumer,
+		pusher:   pusher,
+		options:  opts,
+		local:    map[string][]string{},
+		online:   map[string]map[string]time.Time{},
+		replicas: map[string]time.Time{},
+	}
+}
+
+// EnablePresence tracks the connections of the controller
+func (c *Controller) EnablePresence(p *Presence) {
+	c.presence = p
+}
+
+// EnablePresence tracks the streams of the controller
+func (c *SSEController) EnablePresence(p *Presence) {
+	c.presence = p
+}
+
+// Run receives presence messages of the replicas, sends heartbeats and expires connections
+// until ctx is done, then it tells the replicas the connections of this one are closed
+func (p *Presence) Run(ctx context.Context) error {
+	messages := make(chan []byte)
+	consumed := make(chan error, 1)
+	go func() {
+		consumed <- p.consumer.ConsumeToKey(ctx, p.options.Key, p.options.QueuePrefix+"."+p.id, messages)
+	}()
+	ticker := time.NewTicker(p.options.HeartbeatInterval)
+	defer ticker.Stop()
+	p.heartbeat()
+	for {
+		select {
+		case <-ctx.Done():
+			p.mu.Lock()
+			conns := p.localConns()
+			p.mu.Unlock()
+			p.send(presenceMessage{Type: "disconnect", Connections: conns})
+			return nil
+		case err := <-consumed:
+			if ctx.Err() != nil {
+				continue
+			}
+			return fmt.Errorf("consume presence messages error: %w", err)
+		case m := <-messages:
+			p.receive(m)
+		case <-ticker.C:
+			p.heartbeat()
+			p.expire()
+		}
+	}
+}
+
+// Online reports which of the keys have connections
+func (p *Presence) Online(keys ...string) map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	res := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		res[key] = false
+		for _, expiration := range p.online[key] {
+			if expiration.After(now) {
+				res[key] = true
+				break
+			}
+		}
+	}
+	return res
+}
+
+func (p *Presence) InitRoute(routes gin.IRoutes, path string) {
+	p.GET(serve.Protect(routes, p.Auth, p.Middlewares...), path, func(ctx *gin.Context) error {
+		keys := ctx.QueryArray("key")
+		if len(keys) == 0 {
+			return bindError(ErrNoKeys)
+		}
+		ctx.JSON(http.StatusOK, p.Online(keys...))
+		return nil
+	})
+}
+
+// connect adds the connection of the replica and pushes join events of the keys which come online
+func (p *Presence) connect(conn string, keys []string) {
+	p.mu.Lock()
+	p.local[conn] = keys
+	var joined []string
+	for _, key := range keys {
+		if p.add(key, p.id+"/"+conn) {
+			joined = append(joined, key)
+		}
+	}
+	p.mu.Unlock()
+	p.send(presenceMessage{Type: "connect", Connections: []presenceConn{{Conn: conn, Keys: keys}}})
+	p.push(PresenceJoin, joined)
+}
+
+// disconnect removes the connection of the replica and pushes leave events of the keys which go offline
+func (p *Presence) disconnect(conn string) {
+	p.mu.Lock()
+	keys := p.local[conn]
+	delete(p.local, conn)
+	var left []string
+	for _, key := range keys {
+		if p.remove(key, p.id+"/"+conn) {
+			left = append(left, key)
+		}
+	}
+	p.mu.Unlock()
+	p.send(presenceMessage{Type: "disconnect", Connections: []presenceConn{{Conn: conn, Keys: keys}}})
+	p.push(PresenceLeave, left)
+}
+
+// receive applies a message of a replica, events are pushed by the replica of the connections
+func (p *Presence) receive(body []byte) {
+	var m presenceMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		log.Printf("ws presence: invalid message %s: %s", body, err)
+		return
+	}
+	if m.Replica == p.id {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if m.Type == "heartbeat" {
+		p.replicas[m.Replica] = time.Now()
+	}
+	for _, c := range m.Connections {
+		for _, key := range c.Keys {
+			if m.Type == "disconnect" {
+				p.remove(key, m.Replica+"/"+c.Conn)
+			} else {
+				p.add(key, m.Replica+"/"+c.Conn)
+			}
+		}
+	}
+}
+
+// heartbeat extends the connections of the replica and sends them to the others
+func (p *Presence) heartbeat() {
+	p.mu.Lock()
+	conns := p.localConns()
+	for _, c := range conns {
+		for _, key := range c.Keys {
+			p.add(key, p.id+"/"+c.Conn)
+		}
+	}
+	p.mu.Unlock()
+	p.send(presenceMessage{Type: "heartbeat", Connections: conns})
+}
+
+// expire removes the connections without heartbeats, the leader pushes leave events of their keys
+func (p *Presence) expire() {
+	p.mu.Lock()
+	now := time.Now()
+	leader := true
+	for replica, seen := range p.replicas {
+		if now.Sub(seen) > p.options.TTL {
+			delete(p.replicas, replica)
+		} else if replica < p.id {
+			leader = false
+		}
+	}
+	var left []string
+	for key, conns := range p.online {
+		for conn, expiration := range conns {
+			if !expiration.After(now) {
+				delete(conns, conn)
+			}
+		}
+		if len(conns) == 0 {
+			delete(p.online, key)
+			left = append(left, key)
+		}
+	}
+	p.mu.Unlock()
+	if leader {
+		sort.Strings(left)
+		p.push(PresenceLeave, left)
+	}
+}
+
+// add adds or extends the connection of the key and reports whether the key comes online
+func (p *Presence) add(key, conn string) bool {
+	conns, ok := p.online[key]
+	if !ok {
+		conns = map[string]time.Time{}
+		p.online[key] = conns
+	}
+	conns[conn] = time.Now().Add(p.options.TTL)
+	return !ok
+}
+
+// remove removes the connection of the key and reports whether the key goes offline
+func (p *Presence) remove(key, conn string) bool {
+	conns, ok := p.online[key]
+	if !ok {
+		return false
+	}
+	if _, ok := conns[conn]; !ok {
+		return false
+	}
+	delete(conns, conn)
+	if len(conns) > 0 {
+		return false
+	}
+	delete(p.online, key)
+	return true
+}
+
+func (p *Presence) localConns() []presenceConn {
+	res := make([]presenceConn, 0, len(p.local))
+	for conn, keys := range p.local {
+		res = append(res, presenceConn{Conn: conn, Keys: keys})
+	}
+	return res
+}
+
+func (p *Presence) send(m presenceMessage) {
+	m.Replica = p.id
+	body, err := json.Marshal(m)
+	if err == nil {
+		err = p.sender.Send(p.options.Key, body)
+	}
+	if err != nil {
+		log.Printf("ws presence: send %s error: %s", m.Type, err)
+	}
+}
+
+func (p *Presence) push(eventType string, keys []string) {
+	if p.options.Recipients == nil {
+		return
+	}
+	for _, key := range keys {
+		for _, recipient := range p.options.Recipients(key) {
+			err := p.pusher.Push(recipient, eventType, p.options.Sender, map[string]string{"Key": key})
+			if err != nil {
+				log.Printf("ws presence: push %s of %s error: %s", eventType, key, err)
+			}
+		}
+	}
+}
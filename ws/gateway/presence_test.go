@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeBroker delivers sent messages to every consumer of the key
+type fakeBroker struct {
+	mu        sync.Mutex
+	consumers map[string][]chan []byte
+}
+
+func (b *fakeBroker) Send(key string, env []byte) error {
+	b.mu.Lock()
+	consumers := b.consumers[key]
+	b.mu.Unlock()
+	for _, r := range consumers {
+		select {
+		case r <- env:
+		case <-time.After(100 * time.Millisecond): // the consumer is stopped
+		}
+	}
+	return nil
+}
+
+func (b *fakeBroker) Close() error { return nil }
+
+func (b *fakeBroker) ConsumeToKey(ctx context.Context, key, _ string, r chan []byte) error {
+	b.mu.Lock()
+	b.consumers[key] = append(b.consumers[key], r)
+	b.mu.Unlock()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type pushed struct {
+	key, eType string
+	body       interface{}
+}
+
+type fakePusher struct {
+	mu     sync.Mutex
+	events []pushed
+}
+
+func (f *fakePusher) Push(key, eType string, _ string, body interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, pushed{key, eType, body})
+	return nil
+}
+
+func (f *fakePusher) Close() {}
+
+func (f *fakePusher) take() []pushed {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := f.events
+	f.events = nil
+	return res
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPresence(t *testing.T) {
+	broker := &fakeBroker{consumers: map[string][]chan []byte{}}
+	pusher := &fakePusher{}
+	opts := PresenceOptions{
+		HeartbeatInterval: 20 * time.Millisecond,
+		Recipients:        func(key string) []string { return []string{"presence"} },
+	}
+	a := NewPresence(broker, broker, pusher, opts)
+	b := NewPresence(broker, broker, pusher, opts)
+	a.id, b.id = "a", "b"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = a.Run(ctx) }()
+	bCtx, stopB := context.WithCancel(ctx)
+	go func() { _ = b.Run(bCtx) }()
+	waitFor(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return len(broker.consumers[a.options.Key]) == 2
+	})
+
+	b.connect("1", []string{"user1", "group1"})
+	waitFor(t, func() bool { return a.Online("user1")["user1"] })
+	if events := pusher.take(); len(events) != 2 || events[0].eType != PresenceJoin || events[0].key != "presence" {
+		t.Errorf("unexpected join events %+v", events)
+	}
+	b.connect("2", []string{"user1"})
+	if events := pusher.take(); len(events) != 0 {
+		t.Errorf("online key must not join again %+v", events)
+	}
+	b.disconnect("2")
+	if events := pusher.take(); len(events) != 0 || !b.Online("user1")["user1"] {
+		t.Errorf("key with a connection must stay online %+v", events)
+	}
+
+	// b is gone without disconnecting its clients, a expires them
+	b.mu.Lock()
+	b.local = map[string][]string{}
+	b.mu.Unlock()
+	stopB()
+	waitFor(t, func() bool { return !a.Online("user1", "group1")["group1"] })
+	waitFor(t, func() bool { return len(pusher.take()) > 0 })
+}
+
+func TestRequestKeys_presence(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/?key=user1&key=ws.presence", nil)
+	p := NewPresence(nil, nil, nil, PresenceOptions{})
+	if _, err := requestKeys(ctx, QueryKeys, p, nil); !errors.Is(err, ErrPresenceKey) {
+		t.Errorf("the presence key must be rejected, got %v", err)
+	}
+	if keys, err := requestKeys(ctx, QueryKeys, nil, nil); err != nil || len(keys) != 2 {
+		t.Errorf("unexpected keys without presence %v, %v", keys, err)
+	}
+}
+
+func TestPresence_InitRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := NewPresence(nil, nil, nil, PresenceOptions{})
+	p.online["user1"] = map[string]time.Time{"a/1": time.Now().Add(time.Minute)}
+	r := gin.New()
+	p.InitRoute(r, "/online")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/online?key=user1&key=user2", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"user1":true,"user2":false}` {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body)
+	}
+}
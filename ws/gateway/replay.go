@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/C0nstantin/pkg/ws"
+	"github.com/gin-gonic/gin"
+)
+
+// eventHeader identifies an event pushed by ws.PusherImpl with a History
+type eventHeader struct {
+	Key string
+	Id  uint64
+}
+
+func parseHeader(event []byte) (eventHeader, bool) {
+	var h eventHeader
+	if err := json.Unmarshal(event, &h); err != nil || h.Key == "" || h.Id == 0 {
+		return h, false
+	}
+	return h, true
+}
+
+// replay delivers events a resuming client missed from the history before the live events,
+// it tracks the last delivered id of every key to drop live events delivered from the history
+// and to fill gaps between live events of a key from the history.
+//
+// ws.PusherImpl sends an event after the history assigns its id, so concurrent pushes of a key
+// may arrive out of order of ids. Events of a key with a position are delivered in order of ids:
+// a later event fills the gap from the history and the earlier one is dropped when it arrives.
+// A key without a position starts at its first live event, the history is never read before it,
+// so earlier events arriving after it are delivered as they come, out of order but not lost.
+type replay struct {
+	history ws.History
+	last    map[string]uint64
+	// first is the first live id of the keys without a position
+	first map[string]uint64
+}
+
+func newReplay(history ws.History, since map[string]uint64) *replay {
+	last := make(map[string]uint64, len(since))
+	for key, id := range since {
+		last[key] = id
+	}
+	return &replay{history: history, last: last, first: map[string]uint64{}}
+}
+
+// resume returns the events of the keys after the ids the client has received
+func (r *replay) resume(ctx context.Context) ([][]byte, error) {
+	keys := make([]string, 0, len(r.last))
+	for key := range r.last {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var res [][]byte
+	for _, key := range keys {
+		missed, err := r.since(ctx, key, r.last[key], 0)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, missed...)
+	}
+	return res, nil
+}
+
+// live returns the missed events preceding the live event, the event itself is nil when it is already delivered
+func (r *replay) live(ctx context.Context, event []byte) ([][]byte, []byte, error) {
+	h, ok := parseHeader(event)
+	if !ok { // pushed without a history
+		return nil, event, nil
+	}
+	if first, ok := r.first[h.Key]; ok && h.Id < first {
+		return nil, event, nil
+	}
+	last, ok := r.last[h.Key]
+	if !ok {
+		r.first[h.Key] = h.Id
+	}
+	if ok && h.Id <= last {
+		return nil, nil, nil
+	}
+	var missed [][]byte
+	if ok && h.Id > last+1 {
+		var err error
+		if missed, err = r.since(ctx, h.Key, last, h.Id); err != nil {
+			return nil, nil, err
+		}
+	}
+	r.last[h.Key] = h.Id
+	return missed, event, nil
+}
+
+// since returns the events of the key after id and before the id before, 0 - all
+func (r *replay) since(ctx context.Context, key string, id, before uint64) ([][]byte, error) {
+	events, err := r.history.Since(ctx, key, id)
+	if err != nil {
+		return nil, fmt.Errorf("history of key %s error: %w", key, err)
+	}
+	var res [][]byte
+	for _, e := range events {
+		if before > 0 && e.Id >= before {
+			break
+		}
+		res = append(res, e.Data)
+		r.last[key] = e.Id
+	}
+	return res, nil
+}
+
+// resumePositions returns the last received ids of the keys, the since query parameters
+// key:id take precedence over the positions of the SSE Last-Event-ID, other keys are ignored
+func resumePositions(ctx *gin.Context, keys []string, lastEventID string) map[string]uint64 {
+	res := map[string]uint64{}
+	for key, id := range parsePositions(lastEventID) {
+		if contains(keys, key) {
+			res[key] = id
+		}
+	}
+	for _, s := range ctx.QueryArray("since") {
+		i := strings.LastIndexByte(s, ':')
+		if i < 0 || !contains(keys, s[:i]) {
+			continue
+		}
+		if id, err := strconv.ParseUint(s[i+1:], 10, 64); err == nil {
+			res[s[:i]] = id
+		}
+	}
+	return res
+}
+
+// formatPositions encodes the last ids of keys as an SSE id, key1=4&key2=17
+func formatPositions(positions map[string]uint64) string {
+	v := url.Values{}
+	for key, id := range positions {
+		v.Set(key, strconv.FormatUint(id, 10))
+	}
+	return v.Encode()
+}
+
+func parsePositions(s string) map[string]uint64 {
+	res := map[string]uint64{}
+	v, err := url.ParseQuery(s)
+	if err != nil {
+		return res
+	}
+	for key := range v {
+		if id, err := strconv.ParseUint(v.Get(key), 10, 64); err == nil {
+			res[key] = id
+		}
+	}
+	return res
+}
@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/C0nstantin/pkg/ws"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func appendEvents(t *testing.T, h ws.History, key string, n int) [][]byte {
+	var res [][]byte
+	for i := 0; i < n; i++ {
+		_, err := h.Append(context.Background(), key, func(id uint64) ([]byte, error) {
+			res = append(res, []byte(fmt.Sprintf(`{"Key":%q,"Id":%d}`, key, id)))
+			return res[len(res)-1], nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	h := ws.NewMemoryHistory(10, time.Minute)
+	events := appendEvents(t, h, "user1", 5)
+
+	r := newReplay(h, map[string]uint64{"user1": 2})
+	missed, err := r.resume(ctx)
+	if err != nil || len(missed) != 3 || string(missed[0]) != string(events[2]) {
+		t.Fatalf("unexpected missed events %q, %v", missed, err)
+	}
+	if _, live, _ := r.live(ctx, events[4]); live != nil {
+		t.Errorf("replayed event must be dropped, got %s", live)
+	}
+
+	events = append(events, appendEvents(t, h, "user1", 2)...)
+	missed, live, err := r.live(ctx, events[6])
+	if err != nil || len(missed) != 1 || string(missed[0]) != string(events[5]) || string(live) != string(events[6]) {
+		t.Errorf("gap must be filled from the history, got %q %s %v", missed, live, err)
+	}
+	if _, live, _ := r.live(ctx, []byte(`{"Type":"message"}`)); live == nil {
+		t.Error("event without a history must be forwarded")
+	}
+}
+
+func TestReplay_outOfOrder(t *testing.T) {
+	ctx := context.Background()
+	h := ws.NewMemoryHistory(10, time.Minute)
+	events := appendEvents(t, h, "user1", 4)
+
+	// user1 has no position, the live events 2 and 3 arrive after 4
+	r := newReplay(h, nil)
+	var delivered []string
+	for _, i := range []int{3, 1, 2} {
+		missed, live, err := r.live(ctx, events[i])
+		if err != nil || len(missed) != 0 {
+			t.Fatalf("unexpected missed events %q, %v", missed, err)
+		}
+		if live != nil {
+			delivered = append(delivered, string(live))
+		}
+	}
+	if len(delivered) != 3 {
+		t.Errorf("the events preceding the first live event must be delivered, got %q", delivered)
+	}
+
+	// the id 6 fills 5 from the history, the live 5 arriving after it is dropped
+	events = append(events, appendEvents(t, h, "user1", 2)...)
+	if missed, _, _ := r.live(ctx, events[5]); len(missed) != 1 || string(missed[0]) != string(events[4]) {
+		t.Errorf("gap must be filled from the history, got %q", missed)
+	}
+	if _, live, _ := r.live(ctx, events[4]); live != nil {
+		t.Errorf("replayed event must be dropped, got %s", live)
+	}
+}
+
+func TestResumePositions(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?since=user1:7&since=user2:9&since=bad", nil)
+	since := resumePositions(ctx, []string{"user1", "group.a"}, formatPositions(map[string]uint64{"user1": 3, "group.a": 4}))
+	if len(since) != 2 || since["user1"] != 7 || since["group.a"] != 4 {
+		t.Errorf("unexpected positions %v", since)
+	}
+}
+
+func TestController_replay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := ws.NewMemoryHistory(10, time.Minute)
+	events := appendEvents(t, h, "user1", 3)
+	consumer := newFakeConsumer(1)
+	c := NewController(consumer, Options{})
+	c.EnableReplay(h)
+	r := gin.New()
+	c.InitRoute(r, "/ws")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	defer c.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?key=user1&since=user1:1"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-consumer.ready
+	events = append(events, appendEvents(t, h, "user1", 1)...)
+	consumer.push("user1", string(events[2])) // delivered from the history
+	consumer.push("user1", string(events[3]))
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	for _, want := range events[1:] {
+		_, msg, err := conn.ReadMessage()
+		if err != nil || string(msg) != string(want) {
+			t.Fatalf("unexpected message %s, want %s, %v", msg, want, err)
+		}
+	}
+}
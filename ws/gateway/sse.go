@@ -0,0 +1,262 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/C0nstantin/pkg/serve"
+	"github.com/C0nstantin/pkg/transport/rabbitmq"
+	"github.com/C0nstantin/pkg/ws"
+	"github.com/gin-gonic/gin"
+)
+
+// SSEController serves:
+//
+//	GET /path?key=K1&key=K2    streams events as text/event-stream
+//
+// It is the alternative to the WebSocket Controller for clients behind proxies which break WebSockets,
+// the keys, Auth and Options are the same, PongTimeout and CheckOrigin are not used.
+// Every event is sent as data with the id field connection id-number of the event.
+// EventSource sends the last received id in the Last-Event-ID header when it reconnects,
+// then the stream resumes consuming the queues of the connection, which keep events
+// for a minute after the client is gone. With EnableReplay the id field holds the ids of the last
+// events of the keys, key1=4&key2=17, and the missed events are sent from the history.
+// The queues of a connection must have one consumer, so a stream resuming the id of a stream
+// still served by the controller ends it and waits until its consumers stop. A previous stream
+// served by another replica ends only when its writes fail and the events it consumes until then
+// are lost, route the reconnects of a client to the same replica or use EnableReplay.
+// A comment is sent every PingInterval as the heartbeat, so proxies do not close an idle stream.
+type SSEController struct {
+	serve.BaseController
+	Auth        serve.Auth
+	Middlewares []gin.HandlerFunc
+	// Keys returns the subscription keys of a connection, QueryKeys by default, JWTKeys with EnableJWT
+	Keys Keys
+
+	consumer rabbitmq.Consumer
+	options  Options
+	history  ws.History
+	presence *Presence
+	done     chan struct{}
+	close    sync.Once
+
+	mu      sync.Mutex
+	streams map[string]*activeStream // by connection id
+}
+
+// activeStream is a served stream, a stream resuming its id takes it over
+type activeStream struct {
+	takeover chan struct{} // closed to end the stream
+	stopped  chan struct{} // closed when its consumers are stopped
+}
+
+// NewSSEController creates a controller subscribing streams via consumer,
+// rabbitmq.EventsTransportImpl of the exchange of the ws.Pusher implements it
+func NewSSEController(consumer rabbitmq.Consumer, opts Options) *SSEController {
+	opts.defaults()
+	return &SSEController{
+		Keys:     QueryKeys,
+		consumer: consumer,
+		options:  opts,
+		done:     make(chan struct{}),
+		streams:  map[string]*activeStream{},
+	}
+}
+
+// EnableJWT protects the route with auth, the auth/jwt Auth, and subscribes streams
+// to the keys derived from their tokens. EventSource can not set headers,
+// so the token is passed in the token query parameter or the jwt cookie.
+func (c *SSEController) EnableJWT(auth serve.Auth, keys JWTKeys) {
+	c.Auth = auth
+	c.Keys = keys.Keys
+}
+
+// EnableReplay sends a reconnecting client the events it missed from history before the live events,
+// the ws.PusherImpl must push events with the same history
+func (c *SSEController) EnableReplay(history ws.History) {
+	c.history = history
+}
+
+func (c *SSEController) InitRoute(routes gin.IRoutes, path string) {
+	c.GET(serve.Protect(routes, c.Auth, c.Middlewares...), path, c.connect)
+}
+
+// Close ends every stream, the server shutdown does not wait for streams
+func (c *SSEController) Close() {
+	c.close.Do(func() { close(c.done) })
+}
+
+// connect streams events until the client is gone,
+// errors after the response headers are logged
+func (c *SSEController) connect(ctx *gin.Context) error {
+	keys, err := requestKeys(ctx, c.Keys, c.presence, c.done)
+	if err != nil {
+		return err
+	}
+	s := &sseStream{
+		w:        ctx.Writer,
+		rc:       http.NewResponseController(ctx.Writer),
+		request:  ctx.Request.Context(),
+		options:  c.options,
+		stop:     make(chan struct{}),
+		takeover: make(chan struct{}),
+	}
+	s.id = newID()
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	var since map[string]uint64
+	if c.history != nil {
+		since = resumePositions(ctx, keys, lastEventID)
+		s.positions = make(map[string]uint64, len(since))
+		for key, id := range since {
+			s.positions[key] = id
+		}
+	} else if id, seq, ok := parseEventID(lastEventID); ok {
+		s.id, s.seq = id, seq
+	}
+
+	if c.presence != nil {
+		// a resumed stream has the id of the previous one, which is ended after the resumed
+		// one is tracked, so the keys stay online and presence tracks every stream by its own id
+		streamID := newID()
+		c.presence.connect(streamID, keys)
+		defer c.presence.disconnect(streamID)
+	}
+	active := &activeStream{takeover: s.takeover, stopped: make(chan struct{})}
+	defer c.release(s.id, active)
+	if err := c.acquire(s.id, active); err != nil {
+		return err
+	}
+
+	h := ctx.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // disables buffering of nginx
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Flush()
+
+	conn := newConnection(s.id, s, c.options)
+	if c.history != nil {
+		conn.replay = newReplay(c.history, since)
+	}
+	if err := conn.serve(subscribe(c.consumer, c.options.QueuePrefix, keys), c.done); err != nil {
+		log.Printf("sse gateway: stream %s of %v closed: %s", conn.id, keys, err)
+	}
+	return nil
+}
+
+// acquire registers the stream of the connection id, a previous stream of the id is ended
+// and awaited, so the queues of the connection are not consumed by both
+func (c *SSEController) acquire(id string, active *activeStream) error {
+	c.mu.Lock()
+	prev := c.streams[id]
+	c.streams[id] = active
+	c.mu.Unlock()
+	if prev == nil {
+		return nil
+	}
+	close(prev.takeover)
+	select {
+	case <-prev.stopped:
+		return nil
+	case <-c.done:
+		return errGoingAway
+	}
+}
+
+// release marks the consumers of the stream stopped and unregisters it unless it is taken over
+func (c *SSEController) release(id string, active *activeStream) {
+	c.mu.Lock()
+	if c.streams[id] == active {
+		delete(c.streams, id)
+	}
+	c.mu.Unlock()
+	close(active.stopped)
+}
+
+// sseStream writes events to the response, the client can not answer heartbeats,
+// it is gone when the request context is done
+type sseStream struct {
+	w       gin.ResponseWriter
+	rc      *http.ResponseController
+	request context.Context
+	options Options
+	id      string
+	seq     uint64
+	// positions are the last ids of the keys with a history, nil without it
+	positions map[string]uint64
+	stop      chan struct{}
+	// takeover is closed when a stream resuming the id replaces this one
+	takeover chan struct{}
+}
+
+func (s *sseStream) read() error {
+	select {
+	case <-s.request.Done():
+	case <-s.stop:
+	case <-s.takeover:
+	}
+	return nil
+}
+
+func (s *sseStream) write(event []byte) error {
+	var buf bytes.Buffer
+	if s.positions != nil {
+		if h, ok := parseHeader(event); ok {
+			s.positions[h.Key] = h.Id
+		}
+		fmt.Fprintf(&buf, "id: %s\n", formatPositions(s.positions))
+	} else {
+		s.seq++
+		fmt.Fprintf(&buf, "id: %s-%d\n", s.id, s.seq)
+	}
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return s.send(buf.Bytes())
+}
+
+func (s *sseStream) ping() error {
+	return s.send([]byte(": heartbeat\n\n"))
+}
+
+func (s *sseStream) send(b []byte) error {
+	_ = s.rc.SetWriteDeadline(time.Now().Add(s.options.WriteTimeout)) // not supported by test recorders
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// close ends the response, EventSource reconnects with the last received id
+func (s *sseStream) close(error, bool) {
+	close(s.stop)
+}
+
+// parseEventID returns the connection id and the number of the event of an id field
+func parseEventID(id string) (string, uint64, bool) {
+	i := strings.LastIndexByte(id, '-')
+	if i < 0 {
+		return "", 0, false
+	}
+	// the id is a part of queue names, so it must be generated by newID
+	if b, err := hex.DecodeString(id[:i]); err != nil || len(b) != 8 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return id[:i], seq, true
+}
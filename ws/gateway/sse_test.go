@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSSEController(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	consumer := newFakeConsumer(1)
+	c := NewSSEController(consumer, Options{PingInterval: 50 * time.Millisecond})
+	r := gin.New()
+	c.InitRoute(r, "/events")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	defer c.Close()
+
+	connect := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events?key=user1", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("unexpected content type %s", ct)
+		}
+		select {
+		case <-consumer.ready:
+		case <-time.After(time.Second):
+			t.Fatal("stream is not subscribed")
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+	readEvent := func(r *bufio.Reader) []string {
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				if len(lines) > 0 && !strings.HasPrefix(lines[0], ":") {
+					return lines
+				}
+				lines = nil // heartbeat
+				continue
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	resp, body := connect("")
+	consumer.push("user1", `{"Type":"message"}`)
+	event := readEvent(body)
+	if len(event) != 2 || !strings.HasPrefix(event[0], "id: ") || event[1] != `data: {"Type":"message"}` {
+		t.Fatalf("unexpected event %q", event)
+	}
+	id := strings.TrimPrefix(event[0], "id: ")
+	queue := consumer.queues["user1"]
+	_ = resp.Body.Close()
+
+	resp, body = connect(id)
+	defer resp.Body.Close()
+	if consumer.queues["user1"] != queue {
+		t.Errorf("resumed stream must consume queue %s, got %s", queue, consumer.queues["user1"])
+	}
+	consumer.push("user1", `{"Type":"next"}`)
+	event = readEvent(body)
+	if want := "id: " + strings.TrimSuffix(id, "1") + "2"; event[0] != want {
+		t.Errorf("unexpected id %s, want %s", event[0], want)
+	}
+}
+
+func TestSSEController_takeover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	consumer := newFakeConsumer(1)
+	c := NewSSEController(consumer, Options{})
+	r := gin.New()
+	c.InitRoute(r, "/events")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	defer c.Close()
+
+	connect := func(lastEventID string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events?key=user1", nil)
+		req.Header.Set("Last-Event-ID", lastEventID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-consumer.ready
+		return resp
+	}
+	first := connect("")
+	defer first.Body.Close()
+	queue := consumer.queues["user1"]
+	id := queue[strings.IndexByte(queue, '.')+1 : strings.LastIndexByte(queue, '.')]
+
+	// the client reconnects before the first stream notices it is gone
+	second := connect(id + "-1")
+	defer second.Body.Close()
+	if consumer.queues["user1"] != queue {
+		t.Fatalf("resumed stream must consume queue %s, got %s", queue, consumer.queues["user1"])
+	}
+	if n := consumer.queueConsumers(queue); n != 1 {
+		t.Errorf("queue %s must have one consumer, got %d", queue, n)
+	}
+	if _, err := io.ReadAll(first.Body); err != nil {
+		t.Errorf("the previous stream must be ended, got %v", err)
+	}
+}
+
+func TestParseEventID(t *testing.T) {
+	for _, id := range []string{"", "42", "../x-1", "0123456789abcdef-x", "0123-1"} {
+		if _, _, ok := parseEventID(id); ok {
+			t.Errorf("id %q must be invalid", id)
+		}
+	}
+	if id, seq, ok := parseEventID("0123456789abcdef-7"); !ok || id != "0123456789abcdef" || seq != 7 {
+		t.Errorf("unexpected id %s %d", id, seq)
+	}
+}
+
+func TestSSEController_presence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	consumer := newFakeConsumer(1)
+	broker := &fakeBroker{consumers: map[string][]chan []byte{}}
+	pusher := &fakePusher{}
+	presence := NewPresence(broker, broker, pusher, PresenceOptions{
+		Recipients: func(key string) []string { return []string{"presence"} },
+	})
+	c := NewSSEController(consumer, Options{})
+	c.EnablePresence(presence)
+	r := gin.New()
+	c.InitRoute(r, "/events")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	defer c.Close()
+
+	connect := func(lastEventID string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events?key=user1", nil)
+		req.Header.Set("Last-Event-ID", lastEventID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-consumer.ready
+		return resp
+	}
+	streams := func() int {
+		presence.mu.Lock()
+		defer presence.mu.Unlock()
+		return len(presence.local)
+	}
+
+	// the client reconnects before the previous stream is closed by the server,
+	// the resumed stream takes it over
+	first := connect("0123456789abcdef-3")
+	defer first.Body.Close()
+	second := connect("0123456789abcdef-3")
+	defer second.Body.Close()
+	waitFor(t, func() bool { return streams() == 1 })
+
+	if !presence.Online("user1")["user1"] {
+		t.Error("the key of the resumed stream must stay online")
+	}
+	if events := pusher.take(); len(events) != 1 || events[0].eType != PresenceJoin {
+		t.Errorf("unexpected presence events %+v", events)
+	}
+}
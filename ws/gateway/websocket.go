@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsStream sends events as text messages, the client answers pings with pongs
+type wsStream struct {
+	ws      *websocket.Conn
+	options Options
+}
+
+// read discards messages of the client and extends the read deadline on every pong,
+// a normal close by the client returns nil
+func (s *wsStream) read() error {
+	s.ws.SetReadLimit(4096)
+	_ = s.ws.SetReadDeadline(time.Now().Add(s.options.PongTimeout))
+	s.ws.SetPongHandler(func(string) error {
+		return s.ws.SetReadDeadline(time.Now().Add(s.options.PongTimeout))
+	})
+	for {
+		if _, _, err := s.ws.NextReader(); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (s *wsStream) write(event []byte) error {
+	_ = s.ws.SetWriteDeadline(time.Now().Add(s.options.WriteTimeout))
+	return s.ws.WriteMessage(websocket.TextMessage, event)
+}
+
+func (s *wsStream) ping() error {
+	return s.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.options.WriteTimeout))
+}
+
+func (s *wsStream) close(reason error, byClient bool) {
+	if !byClient {
+		code := websocket.CloseInternalServerErr
+		switch {
+		case errors.Is(reason, ErrSlowClient):
+			code = websocket.CloseTryAgainLater
+		case errors.Is(reason, errGoingAway):
+			code = websocket.CloseGoingAway
+		}
+		_ = s.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason.Error()),
+			time.Now().Add(s.options.WriteTimeout))
+	}
+	_ = s.ws.Close()
+}
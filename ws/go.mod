@@ -1,7 +1,10 @@
 module github.com/C0nstantin/pkg/ws
 
-go 1.19
+go 1.20
 
-require github.com/C0nstantin/pkg/transport/rabbitmq v0.3.2
+require github.com/C0nstantin/pkg/transport/rabbitmq v0.4.0
 
-require github.com/rabbitmq/amqp091-go v1.9.0 // indirect
+require (
+	github.com/C0nstantin/pkg/transport/rabbitmq/dial v0.1.0 // indirect
+	github.com/rabbitmq/amqp091-go v1.9.0 // indirect
+)
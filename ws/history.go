@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event is a pushed event kept in a History
+type Event struct {
+	Id   uint64
+	Data []byte // the JSON sent to clients
+	Date time.Time
+}
+
+// History keeps recent events of every key, so reconnecting clients receive the events they missed.
+// Ids of the events of a key increase monotonically starting from 1.
+type History interface {
+	// Append assigns the next id of the key, stores the event built for the id and returns the id
+	Append(ctx context.Context, key string, build func(id uint64) ([]byte, error)) (uint64, error)
+	// Since returns the kept events of the key with ids greater than id in order of ids
+	Since(ctx context.Context, key string, id uint64) ([]Event, error)
+}
+
+// MemoryHistory keeps the last Size events of every key not older than TTL in memory.
+// Ids start from 1 again when the process restarts, so it suits one pusher process,
+// use the postgres history when several processes push events.
+//
+// The last id of a key is kept after its events expire, because a resuming client drops
+// live events with ids up to the id it has received: were the ids of the key to start again,
+// the client would miss the new events until their ids pass its id. It costs memory for every
+// key ever pushed, so a key without events for Idle, 24h by default, is removed with its last id,
+// Idle must be longer than clients keep their last ids between reconnects.
+type MemoryHistory struct {
+	Size int
+	TTL  time.Duration
+	Idle time.Duration
+
+	mu    sync.Mutex
+	keys  map[string]*keyHistory
+	swept time.Time
+}
+
+type keyHistory struct {
+	last    uint64 // kept after the events expire, so ids do not start again
+	events  []Event
+	updated time.Time
+}
+
+// NewMemoryHistory creates a history keeping size events of every key for ttl,
+// it panics when size or ttl is not positive
+func NewMemoryHistory(size int, ttl time.Duration) *MemoryHistory {
+	if size <= 0 {
+		panic(fmt.Sprintf("ws: history size must be positive, got %d", size))
+	}
+	if ttl <= 0 {
+		panic(fmt.Sprintf("ws: history ttl must be positive, got %s", ttl))
+	}
+	return &MemoryHistory{Size: size, TTL: ttl, Idle: 24 * time.Hour, keys: map[string]*keyHistory{}, swept: time.Now()}
+}
+
+func (h *MemoryHistory) Append(_ context.Context, key string, build func(id uint64) ([]byte, error)) (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k, ok := h.keys[key]
+	if !ok {
+		k = &keyHistory{}
+		h.keys[key] = k
+	}
+	data, err := build(k.last + 1)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	k.last++
+	k.updated = now
+	k.events = append(k.events, Event{Id: k.last, Data: data, Date: now})
+	if len(k.events) > h.Size {
+		k.events = append(k.events[:0:0], k.events[len(k.events)-h.Size:]...)
+	}
+	h.expire(k)
+	if now.Sub(h.swept) >= h.TTL {
+		h.sweep(now)
+	}
+	return k.last, nil
+}
+
+func (h *MemoryHistory) Since(_ context.Context, key string, id uint64) ([]Event, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k, ok := h.keys[key]
+	if !ok {
+		return nil, nil
+	}
+	h.expire(k)
+	var res []Event
+	for _, e := range k.events {
+		if e.Id > id {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+// sweep expires the events of every key and removes the keys idle for Idle
+func (h *MemoryHistory) sweep(now time.Time) {
+	h.swept = now
+	for key, k := range h.keys {
+		if now.Sub(k.updated) >= h.Idle {
+			delete(h.keys, key)
+			continue
+		}
+		h.expire(k)
+	}
+}
+
+// expire removes the events older than TTL
+func (h *MemoryHistory) expire(k *keyHistory) {
+	deadline := time.Now().Add(-h.TTL)
+	i := 0
+	for i < len(k.events) && k.events[i].Date.Before(deadline) {
+		i++
+	}
+	k.events = k.events[i:]
+}
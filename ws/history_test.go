@@ -0,0 +1,116 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type fakeSender struct {
+	sent [][]byte
+}
+
+func (f *fakeSender) Send(_ string, env []byte) error {
+	f.sent = append(f.sent, env)
+	return nil
+}
+
+func (f *fakeSender) Close() error { return nil }
+
+func TestMemoryHistory(t *testing.T) {
+	ctx := context.Background()
+	h := NewMemoryHistory(2, time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := h.Append(ctx, "user1", func(id uint64) ([]byte, error) { return []byte{byte(id)}, nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, _ := h.Since(ctx, "user1", 0)
+	if len(events) != 2 || events[0].Id != 2 || events[1].Id != 3 || events[1].Data[0] != 3 {
+		t.Errorf("unexpected events %+v", events)
+	}
+	if events, _ = h.Since(ctx, "user1", 2); len(events) != 1 {
+		t.Errorf("unexpected events since 2 %+v", events)
+	}
+
+	h.TTL = 0
+	if events, _ = h.Since(ctx, "user1", 0); len(events) != 0 {
+		t.Errorf("expired events are returned %+v", events)
+	}
+	id, _ := h.Append(ctx, "user1", func(id uint64) ([]byte, error) { return nil, nil })
+	if id != 4 {
+		t.Errorf("ids must not start again after the events expire, got %d", id)
+	}
+}
+
+func TestNewMemoryHistory_invalid(t *testing.T) {
+	for _, tc := range []struct {
+		size int
+		ttl  time.Duration
+	}{{0, time.Minute}, {-1, time.Minute}, {10, 0}, {10, -time.Second}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewMemoryHistory(%d, %s) must panic", tc.size, tc.ttl)
+				}
+			}()
+			NewMemoryHistory(tc.size, tc.ttl)
+		}()
+	}
+}
+
+func TestMemoryHistory_idle(t *testing.T) {
+	ctx := context.Background()
+	h := NewMemoryHistory(10, time.Minute)
+	build := func(id uint64) ([]byte, error) { return nil, nil }
+	_, _ = h.Append(ctx, "idle", build)
+	_, _ = h.Append(ctx, "expired", build)
+	_, _ = h.Append(ctx, "expired", build)
+
+	// an hour later, the idle key is gone for a day, the events of the other key are expired
+	h.mu.Lock()
+	h.swept = h.swept.Add(-time.Hour)
+	h.keys["idle"].updated = h.keys["idle"].updated.Add(-25 * time.Hour)
+	h.keys["expired"].updated = h.keys["expired"].updated.Add(-time.Hour)
+	for i := range h.keys["expired"].events {
+		h.keys["expired"].events[i].Date = h.keys["expired"].events[i].Date.Add(-time.Hour)
+	}
+	h.mu.Unlock()
+	_, _ = h.Append(ctx, "active", build)
+
+	h.mu.Lock()
+	_, idle := h.keys["idle"]
+	expired := h.keys["expired"]
+	h.mu.Unlock()
+	if idle {
+		t.Error("the idle key must be removed")
+	}
+	if expired == nil || expired.last != 2 || len(expired.events) != 0 {
+		t.Errorf("the key must keep the last id without the expired events %+v", expired)
+	}
+	if id, _ := h.Append(ctx, "idle", build); id != 1 {
+		t.Errorf("ids of the removed key start again, got %d", id)
+	}
+}
+
+func TestPusherImpl_history(t *testing.T) {
+	sender := &fakeSender{}
+	p := &PusherImpl{Sender: sender, History: NewMemoryHistory(10, time.Minute)}
+	for i := 0; i < 2; i++ {
+		if err := p.Push("user1", "message", "system", "hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var event struct {
+		Key string
+		Id  uint64
+	}
+	if err := json.Unmarshal(sender.sent[1], &event); err != nil || event.Key != "user1" || event.Id != 2 {
+		t.Errorf("unexpected event %s", sender.sent[1])
+	}
+	events, _ := p.History.Since(context.Background(), "user1", 1)
+	if len(events) != 1 || string(events[0].Data) != string(sender.sent[1]) {
+		t.Errorf("unexpected history %+v", events)
+	}
+}
@@ -0,0 +1,21 @@
+module github.com/C0nstantin/pkg/ws/postgres
+
+go 1.21
+
+require (
+	github.com/C0nstantin/pkg/ws v0.1.0
+	github.com/jackc/pgx/v5 v5.5.5
+	github.com/pashagolub/pgxmock/v3 v3.4.0
+)
+
+require (
+	github.com/C0nstantin/pkg/transport/rabbitmq v0.4.0 // indirect
+	github.com/C0nstantin/pkg/transport/rabbitmq/dial v0.1.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/puddle/v2 v2.2.1 // indirect
+	github.com/rabbitmq/amqp091-go v1.9.0 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)
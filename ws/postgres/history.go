@@ -0,0 +1,144 @@
+// Package postgres contains a ws.History keeping events in Postgres,
+// so the pushers and the gateways of several processes share it
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/C0nstantin/pkg/ws"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DB is implemented by *pgxpool.Pool and pgx_client.PgxPoolIface
+type DB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+const DefaultHistoryTable = "ws_events"
+
+// HistorySchema creates the events table and the table of the last ids of keys,
+// %[1]s and %[2]s are their quoted names
+const HistorySchema = `CREATE TABLE IF NOT EXISTS %[1]s (
+	key        TEXT NOT NULL,
+	id         BIGINT NOT NULL,
+	data       BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (key, id)
+);
+CREATE TABLE IF NOT EXISTS %[2]s (
+	key     TEXT PRIMARY KEY,
+	last_id BIGINT NOT NULL
+)`
+
+// History keeps the last Size events of every key not older than TTL. The last id of a key
+// is locked until its event is inserted, so events of a key become visible in order of ids.
+type History struct {
+	db      DB
+	table   string
+	Size    int
+	TTL     time.Duration
+	Timeout time.Duration
+}
+
+// NewHistory creates a history in DefaultHistoryTable keeping size events of every key for ttl,
+// it panics if size or ttl is not positive
+func NewHistory(db DB, size int, ttl time.Duration) *History {
+	if size <= 0 {
+		panic(fmt.Sprintf("ws/postgres: history size must be positive, got %d", size))
+	}
+	if ttl <= 0 {
+		panic(fmt.Sprintf("ws/postgres: history ttl must be positive, got %s", ttl))
+	}
+	return &History{db: db, table: DefaultHistoryTable, Size: size, TTL: ttl, Timeout: 5 * time.Second}
+}
+
+// WithTable makes the history use another table, the last ids are kept in the table with _keys suffix
+func (h *History) WithTable(table string) *History {
+	h.table = table
+	return h
+}
+
+// CreateSchema creates the tables if they don't exist
+func (h *History) CreateSchema(ctx context.Context) error {
+	if _, err := h.db.Exec(ctx, fmt.Sprintf(HistorySchema, h.ident(), h.keysIdent())); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", h.table, err)
+	}
+	return nil
+}
+
+func (h *History) Append(ctx context.Context, key string, build func(id uint64) ([]byte, error)) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var id int64
+	err = tx.QueryRow(ctx, `INSERT INTO `+h.keysIdent()+` (key, last_id) VALUES ($1, 1)
+		ON CONFLICT (key) DO UPDATE SET last_id = `+h.keysIdent()+`.last_id + 1 RETURNING last_id`, key).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next id of key %s: %w", key, err)
+	}
+	data, err := build(uint64(id))
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO `+h.ident()+` (key, id, data) VALUES ($1, $2, $3)`, key, id, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert event: %w", err)
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM `+h.ident()+` WHERE key = $1 AND (id <= $2 OR created_at < `+ttlBound+`)`,
+		key, id-int64(h.Size), h.TTL.Microseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove old events: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit event: %w", err)
+	}
+	return uint64(id), nil
+}
+
+func (h *History) Since(ctx context.Context, key string, id uint64) ([]ws.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	rows, err := h.db.Query(ctx, `SELECT id, data, created_at FROM `+h.ident()+
+		` WHERE key = $1 AND id > $2 AND created_at >= `+ttlBound+` ORDER BY id LIMIT $4`,
+		key, int64(id), h.TTL.Microseconds(), h.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+	var res []ws.Event
+	for rows.Next() {
+		var e ws.Event
+		var id int64
+		if err := rows.Scan(&id, &e.Data, &e.Date); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		e.Id = uint64(id)
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	return res, nil
+}
+
+// ttlBound is the oldest created_at kept for the TTL in microseconds of $3, it is computed by
+// the database like created_at, so the clocks of the processes sharing the history don't matter
+const ttlBound = `now() - $3 * interval '1 microsecond'`
+
+func (h *History) ident() string {
+	return pgx.Identifier{h.table}.Sanitize()
+}
+
+func (h *History) keysIdent() string {
+	return pgx.Identifier{h.table + "_keys"}.Sanitize()
+}
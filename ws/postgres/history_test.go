@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/C0nstantin/pkg/ws"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+var _ ws.History = (*History)(nil)
+
+func TestHistory(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	h := NewHistory(mock, 100, time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "ws_events_keys" .+ RETURNING last_id`).
+		WithArgs("user1").
+		WillReturnRows(pgxmock.NewRows([]string{"last_id"}).AddRow(int64(7)))
+	mock.ExpectExec(`INSERT INTO "ws_events"`).
+		WithArgs("user1", int64(7), []byte(`{"Id":7}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`DELETE FROM "ws_events" WHERE key = \$1 AND \(id <= \$2 OR created_at < now\(\) - \$3 \* interval '1 microsecond'\)`).
+		WithArgs("user1", int64(-93), time.Minute.Microseconds()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+	id, err := h.Append(context.Background(), "user1", func(id uint64) ([]byte, error) {
+		return []byte(`{"Id":7}`), nil
+	})
+	if err != nil || id != 7 {
+		t.Fatalf("unexpected id %d, %v", id, err)
+	}
+
+	mock.ExpectQuery(`SELECT id, data, created_at FROM "ws_events" WHERE key = \$1 AND id > \$2 AND created_at >= now\(\) - \$3 \* interval '1 microsecond' ORDER BY id LIMIT \$4`).
+		WithArgs("user1", int64(5), time.Minute.Microseconds(), 100).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "data", "created_at"}).
+			AddRow(int64(6), []byte(`{"Id":6}`), time.Now()).
+			AddRow(int64(7), []byte(`{"Id":7}`), time.Now()))
+	events, err := h.Since(context.Background(), "user1", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1].Id != 7 {
+		t.Errorf("unexpected events %+v", events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewHistory_invalid(t *testing.T) {
+	for _, tc := range []struct {
+		size int
+		ttl  time.Duration
+	}{{0, time.Minute}, {100, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewHistory(%d, %s) must panic", tc.size, tc.ttl)
+				}
+			}()
+			NewHistory(nil, tc.size, tc.ttl)
+		}()
+	}
+}
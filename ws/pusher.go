@@ -1,8 +1,10 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/C0nstantin/pkg/transport/rabbitmq"
@@ -15,10 +17,18 @@ type Pusher interface {
 
 type PusherImpl struct {
 	Sender rabbitmq.Sender
+	// History keeps pushed events for replay, with it events carry the Key and the Id in the key.
+	// An event is sent after its id is assigned, so concurrent pushes of a key may be sent out of
+	// order of ids: the gateway delivers the events of the keys clients have a position of in order
+	// of ids, filling gaps from the history, other events are delivered as they arrive
+	History History
 }
 
+// Close closes the Sender, Pusher.Close returns nothing, so its error is logged
 func (e *PusherImpl) Close() {
-	e.Sender.Close()
+	if err := e.Sender.Close(); err != nil {
+		log.Printf("ws pusher: close sender error: %s", err)
+	}
 }
 
 // Push send message type wsType with body, for set user use key
@@ -31,6 +41,8 @@ func (e *PusherImpl) Push(key, wsType, sender string, body interface{}) error {
 	}
 
 	event := &struct {
+		Key    string `json:",omitempty"`
+		Id     uint64 `json:",omitempty"`
 		Type   string
 		Sender string
 		Date   time.Time
@@ -41,9 +53,24 @@ func (e *PusherImpl) Push(key, wsType, sender string, body interface{}) error {
 		Date:   time.Now(),
 		Body:   body,
 	}
-	evn, err := json.Marshal(event)
+	if e.History == nil {
+		evn, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return e.Sender.Send(key, evn)
+	}
+
+	var evn []byte
+	_, err := e.History.Append(context.Background(), key, func(id uint64) ([]byte, error) {
+		event.Key, event.Id = key, id
+		var err error
+		evn, err = json.Marshal(event)
+		return evn, err
+	})
 	if err != nil {
 		return err
 	}
+	// the event is in the history even when sending fails, clients receive it on the next event of the key
 	return e.Sender.Send(key, evn)
 }